@@ -1,6 +1,9 @@
 package bits
 
-import "errors"
+import (
+	"bytes"
+	"errors"
+)
 
 // FromUint16 converts a uint16 value to a slice of bools where every set bit is
 // represented by a true value
@@ -66,3 +69,35 @@ func ToBytes(bools []bool) ([]byte, error) {
 
 	return ret, nil
 }
+
+// Repeat returns n copies of data one after the other, so data can be recovered
+// with Majority even if some of the copies are damaged. Keeping the copies apart
+// means damage to a run of bits only ever hits one copy of each bit
+func Repeat(data []byte, n int) []byte {
+	return bytes.Repeat(data, n)
+}
+
+// Majority undoes Repeat, each bit is set if most of its n copies are set
+func Majority(data []byte, n int) ([]byte, error) {
+	if n < 1 || len(data)%n != 0 {
+		return nil, errors.New("len of data must be divisible by n")
+	}
+
+	size := len(data) / n
+	decoded := make([]byte, size)
+	for i := range decoded {
+		for bit := byte(0x80); bit != 0; bit >>= 1 {
+			set := 0
+			for copy := 0; copy < n; copy++ {
+				if data[copy*size+i]&bit != 0 {
+					set++
+				}
+			}
+			if set*2 > n {
+				decoded[i] |= bit
+			}
+		}
+	}
+
+	return decoded, nil
+}
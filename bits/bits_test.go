@@ -1,6 +1,7 @@
 package bits
 
 import (
+	"bytes"
 	"reflect"
 	"strings"
 	"testing"
@@ -266,6 +267,46 @@ func TestToUint8s(t *testing.T) {
 	}
 }
 
+func TestMajority(t *testing.T) {
+	type args struct {
+		data  []byte
+		n     int
+		flips []int
+	}
+	tests := []struct {
+		name string
+		args args
+		want []byte
+	}{
+		{
+			name: "no flips",
+			args: args{data: []byte{0xB1, 0x75}, n: 3},
+			want: []byte{0xB1, 0x75},
+		},
+		{
+			name: "one damaged copy of each bit",
+			args: args{data: []byte{0xB1, 0x75}, n: 3, flips: []int{0, 1, 2, 3, 4, 5, 6, 7, 24, 25, 42, 47}},
+			want: []byte{0xB1, 0x75},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repeated := Repeat(tt.args.data, tt.args.n)
+			for _, flip := range tt.args.flips {
+				repeated[flip/8] ^= 0x80 >> (flip % 8)
+			}
+
+			got, err := Majority(repeated, tt.args.n)
+			if err != nil {
+				t.Fatalf("Majority() unexpected error %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Majority() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
 func fmtBools(bytes []bool) string {
 	s := []string{"["}
 	for _, b := range bytes {
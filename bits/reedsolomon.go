@@ -0,0 +1,326 @@
+package bits
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxCodeword is the longest Reed-Solomon codeword, data and parity together, that
+// can be built over GF(256)
+const MaxCodeword = 255
+
+// ErrTooManyErrors is returned when a codeword has more errors than its parity can
+// correct
+var ErrTooManyErrors = errors.New("too many errors to correct")
+
+// gfPoly is the primitive polynomial x^8 + x^4 + x^3 + x^2 + 1 used to build GF(256)
+const gfPoly = 0x11D
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(256) with generator 2.
+// gfExp is doubled in length so products of two logs never need to wrap
+var gfExp, gfLog = gfTables()
+
+// gfTables builds the exponent and logarithm tables of GF(256)
+func gfTables() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= gfPoly
+		}
+	}
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+
+	return exp, log
+}
+
+// gfMul multiplies a and b in GF(256)
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// gfDiv divides a by b in GF(256), b must not be 0
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// gfPow raises 2, the generator of GF(256), to the power n
+func gfPow(n int) byte {
+	n %= 255
+	if n < 0 {
+		n += 255
+	}
+
+	return gfExp[n]
+}
+
+// RSEncode returns the parity bytes of a systematic Reed-Solomon code for data.
+// Sending data followed by the parity lets RSDecode correct up to parity/2 bytes
+func RSEncode(data []byte, parity int) ([]byte, error) {
+	if parity < 1 || len(data)+parity > MaxCodeword {
+		return nil, fmt.Errorf("a codeword of %d data bytes and %d parity bytes is not supported", len(data), parity)
+	}
+
+	// the generator polynomial has a root at each of the first parity powers of 2
+	gen := []byte{1}
+	for i := 0; i < parity; i++ {
+		next := make([]byte, len(gen)+1)
+		root := gfPow(i)
+		for j, coef := range gen {
+			next[j] ^= coef
+			next[j+1] ^= gfMul(coef, root)
+		}
+		gen = next
+	}
+
+	// the parity is the remainder of data * x^parity divided by the generator
+	remainder := make([]byte, len(data)+parity)
+	copy(remainder, data)
+	for i := range data {
+		coef := remainder[i]
+		if coef == 0 {
+			continue
+		}
+		for j := 1; j < len(gen); j++ {
+			remainder[i+j] ^= gfMul(gen[j], coef)
+		}
+	}
+
+	return remainder[len(data):], nil
+}
+
+// RSDecode corrects a codeword made of data followed by the parity from RSEncode.
+// The codeword is fixed in place and the number of corrected bytes is returned.
+// ErrTooManyErrors is returned when there are more than parity/2 errors
+func RSDecode(codeword []byte, parity int) (int, error) {
+	if parity < 1 || parity >= len(codeword) || len(codeword) > MaxCodeword {
+		return 0, fmt.Errorf("a codeword of %d bytes with %d parity bytes is not supported", len(codeword), parity)
+	}
+
+	syndromes, ok := rsSyndromes(codeword, parity)
+	if ok {
+		return 0, nil
+	}
+
+	locator := rsLocator(syndromes)
+	errs := len(locator) - 1
+	if errs*2 > parity {
+		return 0, ErrTooManyErrors
+	}
+
+	// the roots of the locator are the inverses of the error locations
+	var positions []int
+	var locations []byte
+	for pos := range codeword {
+		x := gfPow(len(codeword) - 1 - pos)
+		if rsEval(locator, gfDiv(1, x)) == 0 {
+			positions = append(positions, pos)
+			locations = append(locations, x)
+		}
+	}
+	if len(positions) != errs {
+		return 0, ErrTooManyErrors
+	}
+
+	magnitudes, err := rsMagnitudes(syndromes, locations)
+	if err != nil {
+		return 0, err
+	}
+	for i, pos := range positions {
+		codeword[pos] ^= magnitudes[i]
+	}
+
+	// a codeword with too many errors can look like a different one with fewer
+	// errors, but then the result is not a valid codeword
+	_, ok = rsSyndromes(codeword, parity)
+	if !ok {
+		return 0, ErrTooManyErrors
+	}
+
+	return errs, nil
+}
+
+// rsSyndromes evaluates the codeword at each root of the generator polynomial, it
+// reports true if they are all 0, which means there are no errors
+func rsSyndromes(codeword []byte, parity int) ([]byte, bool) {
+	syndromes := make([]byte, parity)
+	clean := true
+	for i := range syndromes {
+		x := gfPow(i)
+		var s byte
+		for _, coef := range codeword {
+			s = gfMul(s, x) ^ coef
+		}
+		syndromes[i] = s
+		if s != 0 {
+			clean = false
+		}
+	}
+
+	return syndromes, clean
+}
+
+// rsLocator finds the error locator polynomial from the syndromes using the
+// Berlekamp-Massey algorithm. Coefficients are stored lowest degree first
+func rsLocator(syndromes []byte) []byte {
+	locator := []byte{1}
+	prev := []byte{1}
+	length := 0
+	shift := 1
+	prevDiscrepancy := byte(1)
+	for n := range syndromes {
+		discrepancy := syndromes[n]
+		for i := 1; i <= length && i < len(locator); i++ {
+			discrepancy ^= gfMul(locator[i], syndromes[n-i])
+		}
+		if discrepancy == 0 {
+			shift++
+			continue
+		}
+
+		scale := gfDiv(discrepancy, prevDiscrepancy)
+		next := make([]byte, max(len(locator), len(prev)+shift))
+		copy(next, locator)
+		for i, coef := range prev {
+			next[i+shift] ^= gfMul(scale, coef)
+		}
+
+		if 2*length <= n {
+			prev = locator
+			length = n + 1 - length
+			prevDiscrepancy = discrepancy
+			shift = 1
+		} else {
+			shift++
+		}
+		locator = next
+	}
+
+	for len(locator) < length+1 {
+		locator = append(locator, 0)
+	}
+
+	return locator[:length+1]
+}
+
+// rsEval evaluates a polynomial stored lowest degree first at x
+func rsEval(poly []byte, x byte) byte {
+	var y byte
+	for i := len(poly) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ poly[i]
+	}
+
+	return y
+}
+
+// rsMagnitudes solves for the error values at each location. The syndromes are
+// the sums of each error value times its location raised to the syndrome's power,
+// so the first len(locations) syndromes give a system of linear equations
+func rsMagnitudes(syndromes, locations []byte) ([]byte, error) {
+	n := len(locations)
+	rows := make([][]byte, n)
+	for i := range rows {
+		rows[i] = make([]byte, n+1)
+		for j, x := range locations {
+			rows[i][j] = gfPowOf(x, i)
+		}
+		rows[i][n] = syndromes[i]
+	}
+
+	// gaussian elimination, addition and subtraction are both xor in GF(256)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && rows[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, ErrTooManyErrors
+		}
+		rows[col], rows[pivot] = rows[pivot], rows[col]
+
+		inv := gfDiv(1, rows[col][col])
+		for j := col; j <= n; j++ {
+			rows[col][j] = gfMul(rows[col][j], inv)
+		}
+		for i := 0; i < n; i++ {
+			if i == col || rows[i][col] == 0 {
+				continue
+			}
+			factor := rows[i][col]
+			for j := col; j <= n; j++ {
+				rows[i][j] ^= gfMul(factor, rows[col][j])
+			}
+		}
+	}
+
+	magnitudes := make([]byte, n)
+	for i := range magnitudes {
+		magnitudes[i] = rows[i][n]
+	}
+
+	return magnitudes, nil
+}
+
+// gfPowOf raises x to the power n in GF(256)
+func gfPowOf(x byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if x == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[x])*n%255]
+}
+
+// RSRecover fills in the bytes at the erased positions of a codeword made of data
+// followed by the parity from RSEncode. Up to parity bytes can be recovered as long
+// as every other byte is correct, ErrTooManyErrors is returned otherwise
+func RSRecover(codeword []byte, parity int, erasures []int) error {
+	if parity < 1 || parity >= len(codeword) || len(codeword) > MaxCodeword {
+		return fmt.Errorf("a codeword of %d bytes with %d parity bytes is not supported", len(codeword), parity)
+	}
+	if len(erasures) > parity {
+		return ErrTooManyErrors
+	}
+
+	locations := make([]byte, len(erasures))
+	for i, pos := range erasures {
+		codeword[pos] = 0
+		locations[i] = gfPow(len(codeword) - 1 - pos)
+	}
+
+	syndromes, ok := rsSyndromes(codeword, parity)
+	if ok {
+		return nil
+	}
+
+	magnitudes, err := rsMagnitudes(syndromes, locations)
+	if err != nil {
+		return err
+	}
+	for i, pos := range erasures {
+		codeword[pos] = magnitudes[i]
+	}
+
+	_, ok = rsSyndromes(codeword, parity)
+	if !ok {
+		return ErrTooManyErrors
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package bits
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRSDecode(t *testing.T) {
+	type args struct {
+		data   []byte
+		parity int
+		errors map[int]byte
+	}
+	tests := []struct {
+		name          string
+		args          args
+		wantCorrected int
+		wantErr       error
+	}{
+		{
+			name: "no errors",
+			args: args{
+				data:   []byte("Here's the hidden data"),
+				parity: 8,
+			},
+			wantCorrected: 0,
+		},
+		{
+			name: "one error",
+			args: args{
+				data:   []byte("Here's the hidden data"),
+				parity: 8,
+				errors: map[int]byte{3: 0xFF},
+			},
+			wantCorrected: 1,
+		},
+		{
+			name: "error in the parity",
+			args: args{
+				data:   []byte("Here's the hidden data"),
+				parity: 8,
+				errors: map[int]byte{25: 0x01},
+			},
+			wantCorrected: 1,
+		},
+		{
+			name: "as many errors as can be corrected",
+			args: args{
+				data:   []byte("Here's the hidden data"),
+				parity: 8,
+				errors: map[int]byte{0: 0x01, 7: 0x80, 15: 0x55, 29: 0xAA},
+			},
+			wantCorrected: 4,
+		},
+		{
+			name: "full codeword",
+			args: args{
+				data:   bytes.Repeat([]byte{0xA5}, 223),
+				parity: 32,
+				errors: map[int]byte{0: 0x01, 100: 0x02, 200: 0x03, 254: 0x04},
+			},
+			wantCorrected: 4,
+		},
+		{
+			name: "too many errors",
+			args: args{
+				data:   []byte("Here's the hidden data"),
+				parity: 4,
+				errors: map[int]byte{0: 0x01, 7: 0x80, 15: 0x55},
+			},
+			wantErr: ErrTooManyErrors,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parity, err := RSEncode(tt.args.data, tt.args.parity)
+			if err != nil {
+				t.Fatalf("RSEncode() unexpected error %v", err)
+			}
+			codeword := append(append([]byte{}, tt.args.data...), parity...)
+			for pos, flip := range tt.args.errors {
+				codeword[pos] ^= flip
+			}
+
+			corrected, err := RSDecode(codeword, tt.args.parity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RSDecode() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if corrected != tt.wantCorrected {
+				t.Errorf("RSDecode() corrected = %d, want %d", corrected, tt.wantCorrected)
+			}
+			if !bytes.Equal(codeword[:len(tt.args.data)], tt.args.data) {
+				t.Errorf("RSDecode() = %q, want %q", codeword[:len(tt.args.data)], tt.args.data)
+			}
+		})
+	}
+}
+
+func TestRSEncodeTooLarge(t *testing.T) {
+	_, err := RSEncode(make([]byte, 250), 6)
+	if err == nil {
+		t.Errorf("RSEncode() expected an error for a codeword longer than %d bytes", MaxCodeword)
+	}
+}
+
+func TestRSRecover(t *testing.T) {
+	type args struct {
+		data     []byte
+		parity   int
+		erasures []int
+		errors   map[int]byte
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name: "no erasures",
+			args: args{data: []byte{1, 2, 3}, parity: 2},
+		},
+		{
+			name: "erased data",
+			args: args{data: []byte{1, 2, 3}, parity: 2, erasures: []int{0, 2}},
+		},
+		{
+			name: "erased parity",
+			args: args{data: []byte{1, 2, 3}, parity: 2, erasures: []int{3, 4}},
+		},
+		{
+			name:    "too many erasures",
+			args:    args{data: []byte{1, 2, 3}, parity: 2, erasures: []int{0, 1, 2}},
+			wantErr: ErrTooManyErrors,
+		},
+		{
+			name:    "error outside of the erasures",
+			args:    args{data: []byte{1, 2, 3}, parity: 2, erasures: []int{0}, errors: map[int]byte{2: 0x10}},
+			wantErr: ErrTooManyErrors,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parity, err := RSEncode(tt.args.data, tt.args.parity)
+			if err != nil {
+				t.Fatalf("RSEncode() unexpected error %v", err)
+			}
+			codeword := append(append([]byte{}, tt.args.data...), parity...)
+			want := append([]byte{}, codeword...)
+			for _, pos := range tt.args.erasures {
+				codeword[pos] = 0xEE
+			}
+			for pos, flip := range tt.args.errors {
+				codeword[pos] ^= flip
+			}
+
+			err = RSRecover(codeword, tt.args.parity, tt.args.erasures)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RSRecover() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !bytes.Equal(codeword, want) {
+				t.Errorf("RSRecover() = %v, want %v", codeword, want)
+			}
+		})
+	}
+}
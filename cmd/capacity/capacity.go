@@ -0,0 +1,269 @@
+package capacity
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/bjatkin/imgdemo/cli"
+	"github.com/bjatkin/imgdemo/dct"
+	"github.com/bjatkin/imgdemo/stego"
+)
+
+// capacityArgs are the arguments for the capacity command
+type capacityArgs struct {
+	imagePath string
+}
+
+// Cmd is the capacity command that reports how much data the hide command can fit in an image
+var Cmd = &cli.Cmd[capacityArgs]{
+	Name:        "capacity",
+	Usage:       "capacity [IMAGE PATH]",
+	Description: "report how many bytes of data can be hidden inside an image",
+	Examples: []cli.Example{
+		{
+			Description: "check how much data can be hidden in 'img.png'",
+			Args:        []string{"img.png"},
+			Output: "img.png (1024x1024)\n" +
+				"depth  rgb            rgba           a\n" +
+				"1      393202 bytes   524271 bytes   131055 bytes\n" +
+				"2      786398 bytes   1048536 bytes  262104 bytes\n" +
+				"3      1179597 bytes  1572804 bytes  393156 bytes\n" +
+				"4      1572796 bytes  2097068 bytes  524208 bytes\n" +
+				"\n" +
+				"matrix  rgb           rgba          a\n" +
+				"2       262132 bytes  349512 bytes  87368 bytes\n" +
+				"3       168513 bytes  224686 bytes  56164 bytes\n" +
+				"4       104853 bytes  139804 bytes  34947 bytes\n" +
+				"5       63418 bytes   84558 bytes   21136 bytes\n" +
+				"6       37447 bytes   49929 bytes   12480 bytes\n" +
+				"7       21672 bytes   28896 bytes   7223 bytes\n" +
+				"\n" +
+				"ecc     rgb           rgba          a\n" +
+				"low     368472 bytes  491320 bytes  122776 bytes\n" +
+				"medium  343800 bytes  458424 bytes  114552 bytes\n" +
+				"high    294456 bytes  392632 bytes  98104 bytes\n" +
+				"\n" +
+				"option       rgb           rgba          a\n" +
+				"transparent  393202 bytes  524271 bytes  131055 bytes\n" +
+				"adaptive 4   393199 bytes  524268 bytes  131052 bytes\n" +
+				"adaptive 8   392431 bytes  523244 bytes  130796 bytes\n" +
+				"adaptive 16  103663 bytes  138220 bytes  34540 bytes\n" +
+				"adaptive 32  85231 bytes   113644 bytes  28396 bytes\n" +
+				"\n" +
+				payloadNote,
+		},
+		{
+			Description: "for a baseline jpeg, also check how much data fits in its DCT coefficients when the output is a jpeg",
+			Args:        []string{"img.jpeg"},
+		},
+	},
+	ParseArgs: func(args []string) (capacityArgs, error) {
+		if len(args) != 1 {
+			return capacityArgs{}, errors.New("expected exactly 1 argument")
+		}
+
+		return capacityArgs{
+			imagePath: args[0],
+		}, nil
+	},
+	Fn: func(args capacityArgs) error {
+		imageFile, err := os.Open(args.imagePath)
+		if err != nil {
+			return fmt.Errorf("failed to read image file: %w", err)
+		}
+		defer imageFile.Close()
+
+		img, name, err := image.Decode(imageFile)
+		if err != nil {
+			return fmt.Errorf("failed to decode image file: %w", err)
+		}
+
+		// the hide command uses every frame of an animated gif
+		if name == "gif" {
+			_, err = imageFile.Seek(0, io.SeekStart)
+			if err == nil {
+				img, err = stego.DecodeGIF(imageFile)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to decode gif file: %w", err)
+			}
+		}
+
+		// the hide command hides data in the DCT coefficients of baseline jpegs when
+		// writing a jpeg, but in the pixels when writing a png or gif, so both are shown
+		var jpeg *stego.JPEG
+		if name == "jpeg" {
+			_, err = imageFile.Seek(0, io.SeekStart)
+			if err != nil {
+				return fmt.Errorf("failed to decode jpeg file: %w", err)
+			}
+			jpeg, err = stego.DecodeJPEG(imageFile)
+			if err != nil && !errors.Is(err, dct.ErrUnsupported) {
+				return fmt.Errorf("failed to decode jpeg file: %w", err)
+			}
+		}
+
+		// the hide command copies images it can't hide data in directly into an NRGBA
+		// image so measure the image the same way
+		carrier, ok := stego.Carrier(img)
+		if !ok {
+			rgbaImg := image.NewNRGBA(img.Bounds())
+			draw.Draw(rgbaImg, img.Bounds(), img, image.Pt(0, 0), draw.Src)
+			carrier = rgbaImg
+		}
+
+		pix, format, err := stego.Pixels(carrier)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s (%dx%d)\n", args.imagePath, img.Bounds().Dx(), img.Bounds().Dy())
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, line := range capacity(pix, format, stego.Stride(carrier)) {
+			fmt.Fprintln(w, line)
+		}
+
+		if jpeg != nil {
+			pix, format, err = stego.Pixels(jpeg)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(w, "\njpeg output (.jpg, .jpeg)")
+			for _, line := range capacity(pix, format, 0) {
+				fmt.Fprintln(w, line)
+			}
+		}
+
+		fmt.Fprintln(w, "\n"+payloadNote)
+		return w.Flush()
+	},
+}
+
+// channelSets are the channel sets shown for each depth
+var channelSets = []stego.Channels{stego.RGB, stego.RGBA, stego.Alpha}
+
+// eccLevels are the error correction levels shown in the ecc table
+var eccLevels = []string{"low", "medium", "high"}
+
+// adaptiveScores are the texture scores shown in the option table
+var adaptiveScores = []uint8{4, 8, 16, 32}
+
+// payloadNote explains what counts against the capacity on top of the hidden file
+const payloadNote = "sizes are for the whole payload, which also holds the file's name, size, mode, " +
+	"modification time and MIME type in about 16 bytes plus the length of the name and type. " +
+	"Encryption takes another 48 bytes with a password, or 64 bytes plus 50 for each recipient"
+
+// capacity returns tab separated tables of the largest payload, in bytes, that fits in
+// the pixel data for every embedding setting supported by the hide command. The stride
+// of the pixel data is needed to score texture for the adaptive rows
+func capacity(pix []uint8, format stego.Format, stride int) []string {
+	// gray, paletted and jpeg images only have one kind of sample so they get a single
+	// column
+	columns := ""
+	sets := channelSets
+	switch format {
+	case stego.FormatGray, stego.FormatGray16:
+		columns, sets = "\tgray", []stego.Channels{stego.RGB}
+	case stego.FormatPaletted:
+		columns, sets = "\tpalette", []stego.Channels{stego.RGB}
+	case stego.FormatJPEG:
+		columns, sets = "\tdct", []stego.Channels{stego.RGB}
+	default:
+		for _, channels := range sets {
+			columns += "\t" + channels.String()
+		}
+	}
+	lines := []string{"depth" + columns}
+
+	// only the lowest bit of a paletted sample or a DCT coefficient can be used
+	maxDepth := stego.MaxDepth
+	if format == stego.FormatPaletted || format == stego.FormatJPEG {
+		maxDepth = 1
+	}
+	for depth := 1; depth <= maxDepth; depth++ {
+		lines = append(lines, row(strconv.Itoa(depth), pix, format, stride, sets, newHeader(uint8(depth))))
+	}
+
+	// matrix embedding only works at depth 1 so it gets a table of its own, split
+	// from the first by an empty line
+	lines = append(lines, "", "matrix"+columns)
+	for matrix := 2; matrix <= stego.MaxMatrix; matrix++ {
+		header := newHeader(1)
+		header.Matrix = uint8(matrix)
+		lines = append(lines, row(strconv.Itoa(matrix), pix, format, stride, sets, header))
+	}
+
+	// error correction works at any depth, but only depth 1 is shown to keep it short
+	lines = append(lines, "", "ecc"+columns)
+	for _, level := range eccLevels {
+		parity, err := stego.ParseECC(level)
+		if err != nil {
+			continue
+		}
+		header := newHeader(1)
+		header.Parity = parity
+		lines = append(lines, row(level, pix, format, stride, sets, header))
+	}
+
+	// how much transparent and adaptive change the capacity depends on the image, so
+	// they are measured too. A jpeg has no transparent pixels or texture to score
+	if format == stego.FormatJPEG {
+		return lines
+	}
+	lines = append(lines, "", "option"+columns)
+	if !format.Single() {
+		header := newHeader(1)
+		header.Flags |= stego.FlagTransparent
+		lines = append(lines, row("transparent", pix, format, stride, sets, header))
+	}
+	for _, score := range adaptiveScores {
+		header := newHeader(1)
+		header.Texture = score
+		lines = append(lines, row(fmt.Sprintf("adaptive %d", score), pix, format, stride, sets, header))
+	}
+
+	return lines
+}
+
+// newHeader returns a header for data hidden at depth. It's built the same way as the
+// hide command's, which always adds a checksum
+func newHeader(depth uint8) stego.Header {
+	return stego.Header{
+		Version: stego.Version,
+		Flags:   stego.FlagChecksum,
+		Depth:   depth,
+	}
+}
+
+// row returns one tab separated line of a capacity table with the largest payload that
+// can be hidden with header for each channel set
+func row(label string, pix []uint8, format stego.Format, stride int, sets []stego.Channels, header stego.Header) string {
+	line := label
+	for _, channels := range sets {
+		header.Channels = channels
+		line += fmt.Sprintf("\t%d bytes", header.Capacity(layout(header, format, stride).Count(pix)))
+	}
+
+	return line
+}
+
+// layout returns the layout used to hide the data that follows header in pixel data of
+// the given format and stride. Like the hide command, the header itself is not counted
+// separately even though it ignores texture
+func layout(header stego.Header, format stego.Format, stride int) stego.Layout {
+	layout := header.Layout("")
+	layout.Format = format
+	layout.Stride = stride
+	layout.Texture = header.Texture
+	return layout
+}
@@ -0,0 +1,172 @@
+package capacity
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bjatkin/imgdemo/cmd/hide"
+	"github.com/bjatkin/imgdemo/stego"
+)
+
+func Test_capacity(t *testing.T) {
+	// a busy image with a transparent corner, so transparent and adaptive both change
+	// the capacity
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			alpha := uint8(0xFF)
+			if x < 8 && y < 8 {
+				alpha = 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(rng.Uint32()), uint8(rng.Uint32()), uint8(rng.Uint32()), alpha})
+		}
+	}
+
+	dir := t.TempDir()
+	coverPath := filepath.Join(dir, "cover.png")
+	fout, err := os.Create(coverPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(fout, img)
+	fout.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pix, format, err := stego.Pixels(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := parseTables(t, capacity(pix, format, stego.Stride(img)))
+
+	tests := []struct {
+		table  string
+		row    string
+		column string
+		args   []string
+	}{
+		{table: "depth", row: "1", column: "rgb"},
+		{table: "depth", row: "3", column: "rgba", args: []string{"-depth", "3", "-channels", "rgba"}},
+		{table: "matrix", row: "3", column: "rgb", args: []string{"-matrix", "3"}},
+		{table: "ecc", row: "medium", column: "rgb", args: []string{"-ecc", "medium"}},
+		{table: "option", row: "transparent", column: "rgba", args: []string{"-transparent", "-channels", "rgba"}},
+		{table: "option", row: "adaptive 8", column: "rgb", args: []string{"-adaptive", "8"}},
+		{table: "option", row: "adaptive 32", column: "rgba", args: []string{"-adaptive", "32", "-channels", "rgba"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table+" "+tt.row+" "+tt.column, func(t *testing.T) {
+			size, ok := tables[tt.table][tt.row][tt.column]
+			if !ok {
+				t.Fatalf("capacity() has no %s %s %s value", tt.table, tt.row, tt.column)
+			}
+			if tt.table == "option" && size == tables["depth"]["1"][tt.column] {
+				t.Errorf("capacity() %s is the same as depth 1", tt.row)
+			}
+
+			err := hidePayload(t, coverPath, size, tt.args)
+			if err != nil {
+				t.Errorf("hide failed with a %d byte payload: %v", size, err)
+			}
+
+			err = hidePayload(t, coverPath, size+1, tt.args)
+			if err == nil {
+				t.Errorf("hide did not fail with a %d byte payload", size+1)
+			}
+		})
+	}
+}
+
+// parseTables reads the tables returned by capacity into sizes by table, row and column
+func parseTables(t *testing.T, lines []string) map[string]map[string]map[string]int {
+	t.Helper()
+	tables := map[string]map[string]map[string]int{}
+	var columns []string
+	var table map[string]map[string]int
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		switch {
+		case line == "":
+			table = nil
+		case table == nil:
+			table = map[string]map[string]int{}
+			tables[fields[0]] = table
+			columns = fields[1:]
+		default:
+			row := map[string]int{}
+			for i, field := range fields[1:] {
+				size, err := strconv.Atoi(strings.TrimSuffix(field, " bytes"))
+				if err != nil {
+					t.Fatalf("invalid capacity %q: %v", field, err)
+				}
+				row[columns[i]] = size
+			}
+			table[fields[0]] = row
+		}
+	}
+
+	return tables
+}
+
+// hidePayload runs the hide command with args on the cover, using a file that makes a
+// payload of exactly size bytes
+func hidePayload(t *testing.T, coverPath string, size int, args []string) error {
+	t.Helper()
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "secret.dat")
+	err := os.WriteFile(dataPath, nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the payload is the envelope hide builds around the file, find the file size that
+	// makes it the right size
+	const mimeType = "application/octet-stream"
+	envelope := stego.Envelope{Name: info.Name(), Mode: info.Mode().Perm(), ModTime: info.ModTime(), MIME: mimeType}
+	empty, err := envelope.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := size - len(empty); n >= 0; n-- {
+		envelope.Data = make([]byte, n)
+		payload, err := envelope.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payload) == size {
+			break
+		}
+	}
+	if payload, _ := envelope.MarshalBinary(); len(payload) != size {
+		t.Fatalf("no file makes a %d byte payload", size)
+	}
+
+	err = os.WriteFile(dataPath, envelope.Data, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(dataPath, info.ModTime(), info.ModTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args = append(args, "-compress", "never", "-mime", mimeType, coverPath, dataPath, filepath.Join(dir, "img.png"))
+	hideArgs, err := hide.Cmd.ParseArgs(args)
+	if err != nil {
+		t.Fatalf("hide ParseArgs() unexpected error %v", err)
+	}
+
+	return hide.Cmd.Fn(hideArgs)
+}
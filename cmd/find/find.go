@@ -1,27 +1,56 @@
 package find
 
 import (
+	"bytes"
+	"crypto/ecdh"
 	"errors"
+	"flag"
 	"fmt"
 	"image"
-	"image/png"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"os"
-	"strings"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
 
-	"github.com/bjatkin/imgdemo/bits"
 	"github.com/bjatkin/imgdemo/cli"
-	"github.com/bjatkin/imgdemo/cmd/hide"
+	"github.com/bjatkin/imgdemo/dct"
+	"github.com/bjatkin/imgdemo/pngchunk"
+	"github.com/bjatkin/imgdemo/stego"
 )
 
 // findArgs are the arguments for the find command
 type findArgs struct {
-	imagePath string
+	imagePaths     []string
+	outputDir      string
+	info           bool
+	privateKeyPath string
+	options        findOptions
+}
+
+// errLossy is returned for images saved with lossy compression, which changes the low
+// bits that data is hidden in
+var errLossy = errors.New("the image was saved with lossy compression, which destroys data hidden in its pixels")
+
+// errNotBaseline is returned for jpegs that the hide command could not have written,
+// like progressive ones
+var errNotBaseline = errors.New("data can only be hidden in baseline jpeg images")
+
+// findOptions control how hidden data is read from the image
+type findOptions struct {
+	password   string
+	privateKey *ecdh.PrivateKey
+	key        string
 }
 
 // Cmd is the find command that searches the given image for data hidden using the hide command
 var Cmd = &cli.Cmd[findArgs]{
 	Name:        "find",
-	Usage:       "find [IMAGE PATH]",
+	Usage:       "find [-password PASSWORD] [-private-key PRIVATE KEY PATH] [-key KEY] [-o OUTPUT DIR] [--info] [IMAGE PATH...]",
 	Description: "find data hidden inside an image",
 	Examples: []cli.Example{
 		{
@@ -29,86 +58,597 @@ var Cmd = &cli.Cmd[findArgs]{
 			Args:        []string{"img.png"},
 			Output:      "Here's the hidden data",
 		},
+		{
+			Description: "restore the hidden file, or extract every file of a hidden archive, from 'img.png' into the 'out' directory",
+			Args:        []string{"-o", "out", "img.png"},
+		},
+		{
+			Description: "show information about the hidden file without reading it",
+			Args:        []string{"--info", "img.png"},
+			Output: "name:     secret.dat\n" +
+				"size:     40 bytes\n" +
+				"mode:     -rw-r--r--\n" +
+				"modified: 2024-08-31T10:12:44-06:00\n" +
+				"type:     application/octet-stream",
+		},
+		{
+			Description: "list the files in an archive hidden in 'img.png'",
+			Args:        []string{"img.png"},
+			Output: "-rw-r--r--  231   2024-09-02T08:30:00-06:00  config.yml\n" +
+				"-rw-------  411   2024-09-02T08:31:12-06:00  id.key\n" +
+				"drwxr-xr-x  0     2024-09-02T08:29:41-06:00  docs/\n" +
+				"-rw-r--r--  1254  2024-09-02T08:29:41-06:00  docs/README.md",
+		},
+		{
+			Description: "put data split across every image in the 'out' directory back together",
+			Args:        []string{"out/*.png"},
+			Output:      "Here's the hidden data",
+		},
+		{
+			Description: "put split data back together when one of the images was lost",
+			Args:        []string{"a.png", "c.png"},
+			Error:       fmt.Errorf("%w: found 2 of 3 shards, missing 2", stego.ErrMissingShards),
+		},
+		{
+			Description: "data can only be found in baseline jpeg images, not progressive ones like 'img.jpeg'",
+			Args:        []string{"img.jpeg"},
+			Error:       fmt.Errorf("%w, 'img.jpeg' is progressive or has more than one scan", errNotBaseline),
+		},
+		{
+			Description: "data hidden in the pixels of a png does not survive it being saved as a jpeg",
+			Args:        []string{"img.jpeg"},
+			Error:       fmt.Errorf("%w: %w", errLossy, stego.ErrNoPayload),
+		},
 		{
 			Description: "searching for hidden data in 'img.png' fails",
 			Args:        []string{"img.png"},
-			Error:       errors.New("magic number does not match"),
+			Error:       stego.ErrNoPayload,
+		},
+		{
+			Description: "hidden data in 'img.png' was damaged after it was hidden",
+			Args:        []string{"img.png"},
+			Error:       stego.ErrCorrupted,
+		},
+		{
+			Description: "find data that was encrypted for the public key matching the private key in 'id.pem'",
+			Args:        []string{"-private-key", "id.pem", "img.png"},
+			Output:      "Here's the hidden data",
+		},
+		{
+			Description: "find data that was encrypted for other recipients",
+			Args:        []string{"-private-key", "id.pem", "img.png"},
+			Error:       stego.ErrNotRecipient,
+		},
+		{
+			Description: "find encrypted data using the wrong password",
+			Args:        []string{"-password", "hunter3", "img.png"},
+			Error:       stego.ErrAuthentication,
 		},
 	},
 	ParseArgs: func(args []string) (findArgs, error) {
-		if len(args) != 1 {
+		var options findOptions
+		var outputDir string
+		var info bool
+		var privateKeyPath string
+		flags := flag.NewFlagSet("find", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.StringVar(&options.password, "password", "", "password used to decrypt the data")
+		flags.StringVar(&privateKeyPath, "private-key", "", "PEM file with the private key used to decrypt data hidden for recipients")
+		flags.StringVar(&options.key, "key", "", "key used to scatter the data over the image")
+		flags.StringVar(&outputDir, "o", "", "restore the hidden file into this directory")
+		flags.BoolVar(&info, "info", false, "only print information about the hidden file")
+		err := flags.Parse(args)
+		if err != nil {
+			return findArgs{}, err
+		}
+		args = flags.Args()
+
+		if len(args) < 1 {
 			return findArgs{}, errors.New("invalid argument count")
 		}
 
-		if !strings.HasSuffix(args[0], ".png") {
-			return findArgs{}, errors.New("only png images are supported")
+		// patterns are expanded here so globs work even when the shell leaves them alone
+		var imagePaths []string
+		for _, pattern := range args {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return findArgs{}, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				matches = []string{pattern}
+			}
+			imagePaths = append(imagePaths, matches...)
 		}
 
 		return findArgs{
-			imagePath: args[0],
+			imagePaths:     imagePaths,
+			outputDir:      outputDir,
+			info:           info,
+			privateKeyPath: privateKeyPath,
+			options:        options,
 		}, nil
 	},
 	Fn: func(args findArgs) error {
-		f, err := os.Open(args.imagePath)
-		if err != nil {
-			return fmt.Errorf("failed to read in an image file: %w", err)
+		if args.privateKeyPath != "" {
+			var err error
+			args.options.privateKey, err = readPrivateKey(args.privateKeyPath)
+			if err != nil {
+				return err
+			}
 		}
-		defer f.Close()
 
-		inImage, err := png.Decode(f)
-		if err != nil {
-			return fmt.Errorf("failed to decode png file: %w", err)
-		}
+		images := make([]image.Image, len(args.imagePaths))
+		for i, path := range args.imagePaths {
+			var err error
+			images[i], err = readImage(path)
+			if err != nil {
+				return err
+			}
 
-		img, ok := inImage.(*image.NRGBA)
-		if !ok {
-			return fmt.Errorf("invalid image format: %T", img)
+			chunk, err := readChunk(path)
+			if err != nil {
+				return err
+			}
+			if chunk != nil {
+				images[i] = &chunkImage{Image: images[i], chunk: chunk}
+			}
 		}
 
-		got, err := findData(img)
+		got, corrected, err := findData(images, args.options)
 		if err != nil {
 			return fmt.Errorf("failed to get hidden data: %w", err)
 		}
+		if corrected > 0 {
+			fmt.Fprintf(os.Stderr, "corrected %d damaged bytes of hidden data\n", corrected)
+		}
+
+		switch {
+		case args.info:
+			printInfo(got)
+		case args.outputDir != "" && got.Archive:
+			return stego.ExtractArchive(args.outputDir, got.Data)
+		case args.outputDir != "":
+			return restoreFile(args.outputDir, got)
+		case got.Archive:
+			return printArchive(got.Data)
+		default:
+			fmt.Print(string(got.Data))
+		}
 
-		fmt.Print(string(got))
 		return nil
 	},
 }
 
-// findData searches an image for data hidden using the hide command
-// it first checks for the MagicNumber, if it's found it then pulls the
-// data from the lowest bits of the image
-func findData(image *image.NRGBA) ([]byte, error) {
-	// check for the magic number
-	var magic []bool
-	for i := 0; i < 16; i++ {
-		magic = append(magic, image.Pix[i]&0x01 == 1)
+// readImage decodes the image at path into one of the image types the hide command
+// writes. Images that were saved with a different color model, for example by
+// another tool, are converted back so their samples are read in the same order hide
+// wrote them
+func readImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read in an image file: %w", err)
+	}
+	defer f.Close()
+
+	inImage, format, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image file '%s': %w", path, err)
+	}
+	// data is hidden in the DCT coefficients of a jpeg, which only works for baseline
+	// jpegs
+	if format == "jpeg" {
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode jpeg file '%s': %w", path, err)
+		}
+
+		img, err := stego.DecodeJPEG(f)
+		if errors.Is(err, dct.ErrUnsupported) {
+			return nil, fmt.Errorf("%w, '%s' is progressive or has more than one scan", errNotBaseline, path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode jpeg file '%s': %w", path, err)
+		}
+		return img, nil
+	}
+
+	// data is hidden in every frame of an animated gif, in order
+	if format == "gif" {
+		_, err = f.Seek(0, io.SeekStart)
+		if err == nil {
+			inImage, err = stego.DecodeGIF(f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode gif file '%s': %w", path, err)
+		}
+	}
+
+	// the png encoder writes fully opaque images without an alpha channel, which
+	// happens whenever it's left untouched, and they are decoded as RGBA or RGBA64
+	img, ok := stego.Carrier(inImage)
+	if ok {
+		return img, nil
+	}
+
+	// converting premultiplied colors back can change the samples of translucent
+	// pixels, any data hidden in them fails its checksum rather than being returned
+	switch inImage := inImage.(type) {
+	case *image.RGBA:
+		nrgba := image.NewNRGBA(inImage.Bounds())
+		draw.Draw(nrgba, inImage.Bounds(), inImage, inImage.Bounds().Min, draw.Src)
+		return nrgba, nil
+	case *image.RGBA64:
+		nrgba := image.NewNRGBA64(inImage.Bounds())
+		draw.Draw(nrgba, inImage.Bounds(), inImage, inImage.Bounds().Min, draw.Src)
+		return nrgba, nil
+	default:
+		return nil, fmt.Errorf("invalid image format: %T", inImage)
+	}
+}
+
+// chunkImage is an image with the data of a chunk written by the hide command's chunk
+// mode
+type chunkImage struct {
+	image.Image
+	chunk []byte
+}
+
+// readChunk returns the data of the chunk written by the hide command's chunk mode, or
+// nil if the image at path is not a png or has no such chunk
+func readChunk(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read in an image file: %w", err)
+	}
+	defer f.Close()
+
+	chunks, err := pngchunk.Read(f)
+	if errors.Is(err, pngchunk.ErrNotPNG) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read png chunks from '%s': %w", path, err)
+	}
+
+	chunk, ok := pngchunk.Find(chunks, stego.ChunkType)
+	if !ok {
+		return nil, nil
+	}
+
+	return chunk.Data, nil
+}
+
+// findData searches images for data hidden using the hide command. When there is
+// more than one image each of them must hold a shard of the same payload, which are
+// put back together in order. Erasure coded shards only need some of the images, so
+// images that can't be read are left out and JoinShards treats them as missing. It also
+// returns the number of bytes fixed by error correction
+func findData(images []image.Image, options findOptions) (stego.Envelope, int, error) {
+	var headers []stego.Header
+	var payloads [][]byte
+	var firstErr error
+	erasure := false
+	corrected := 0
+	for i, image := range images {
+		header, payload, n, err := findPayload(image, options.key)
+		if err != nil {
+			if len(images) > 1 {
+				err = fmt.Errorf("image %d: %w", i+1, err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		headers = append(headers, header)
+		payloads = append(payloads, payload)
+		erasure = erasure || header.Shard.Need != 0
+		corrected += n
+	}
+	if firstErr != nil && !erasure {
+		return stego.Envelope{}, 0, firstErr
+	}
+
+	header, data, err := stego.JoinShards(headers, payloads)
+	if errors.Is(err, stego.ErrMissingShards) && firstErr != nil {
+		err = fmt.Errorf("%w, %v", err, firstErr)
+	}
+	if err != nil {
+		return stego.Envelope{}, 0, err
+	}
+
+	envelope, err := decodeData(header, data, options)
+	return envelope, corrected, err
+}
+
+// findPayload searches an image for data hidden using the hide command. Data stored
+// in a chunk is read first, before falling back to the pixels. Paletted images are
+// searched as they are first, and then as NRGBA images in case another tool saved a
+// truecolor image with a palette
+func findPayload(img image.Image, key string) (stego.Header, []byte, int, error) {
+	if chunked, ok := img.(*chunkImage); ok {
+		header, data, corrected, err := chunkPayload(chunked.chunk)
+		if !errors.Is(err, stego.ErrNoPayload) {
+			return header, data, corrected, err
+		}
+		img = chunked.Image
+	}
+
+	header, data, corrected, err := searchPayload(img, key)
+	// a jpeg without data in its coefficients may still be a stego png that was saved
+	// as a jpeg, which can't have kept the low bits of its pixels
+	if _, ok := img.(*stego.JPEG); ok && errors.Is(err, stego.ErrNoPayload) {
+		return stego.Header{}, nil, 0, fmt.Errorf("%w: %w", errLossy, err)
+	}
+
+	paletted, ok := img.(*image.Paletted)
+	if !ok || !errors.Is(err, stego.ErrNoPayload) {
+		return header, data, corrected, err
+	}
+
+	nrgba := image.NewNRGBA(paletted.Bounds())
+	draw.Draw(nrgba, paletted.Bounds(), paletted, paletted.Bounds().Min, draw.Src)
+	return searchPayload(nrgba, key)
+}
+
+// searchPayload searches an image for data hidden using the hide command
+// it first looks for a header in every layout the hide command could have used,
+// once one is found it then pulls the data from the lowest bits of the image, fixing
+// any errors it can if the data has error correction
+func searchPayload(image image.Image, key string) (stego.Header, []byte, int, error) {
+	pix, format, err := stego.Pixels(image)
+	if err != nil {
+		return stego.Header{}, nil, 0, err
+	}
+	stride := stego.Stride(image)
+
+	// keep looking if a header turns out to be invalid since the magic number can
+	// match by chance, but report it as corrupted data if nothing else is found.
+	// Versioned headers are looked for first because a legacy header is only a magic
+	// number and a length, so it's the easiest to match by chance
+	headerErr := stego.ErrNoPayload
+	for _, legacy := range []bool{false, true} {
+		for _, layout := range layouts(key, format, stride) {
+			r := stego.NewReader(pix, layout)
+			header, err := stego.ReadHeader(r)
+			if err != nil {
+				if !legacy && !errors.Is(err, stego.ErrNoPayload) && errors.Is(headerErr, stego.ErrNoPayload) {
+					headerErr = fmt.Errorf("%w: %v", stego.ErrCorrupted, err)
+				}
+				continue
+			}
+			if (header.Version == 0) != legacy {
+				continue
+			}
+
+			// make sure the header was actually written using this layout, the format
+			// and stride come from the image rather than the header
+			want := header.Layout(key)
+			want.Format = format
+			want.Stride = stride
+			if want != layout {
+				continue
+			}
+
+			// make sure the length is sane before allocating space for the data
+			r.Depth = int(header.Depth)
+			r.Matrix = int(header.Matrix)
+			r.SetTexture(header.Texture)
+			if header.Length > uint64(r.Remaining()/8) {
+				if errors.Is(headerErr, stego.ErrNoPayload) {
+					headerErr = fmt.Errorf("%w: data length %d is larger than the image", stego.ErrCorrupted, header.Length)
+				}
+				continue
+			}
+
+			data := make([]byte, header.Length)
+			_, err = r.Read(data)
+			if err != nil {
+				return stego.Header{}, nil, 0, fmt.Errorf("failed to read hidden data: %w", err)
+			}
+
+			return verifyPayload(header, data)
+		}
+	}
+
+	return stego.Header{}, nil, 0, headerErr
+}
+
+// chunkPayload reads the header and data stored in a chunk by the hide command's
+// chunk mode
+func chunkPayload(chunk []byte) (stego.Header, []byte, int, error) {
+	r := bytes.NewReader(chunk)
+	header, err := stego.ReadHeader(r)
+	if err != nil && !errors.Is(err, stego.ErrNoPayload) {
+		err = fmt.Errorf("%w: %v", stego.ErrCorrupted, err)
+	}
+	if err != nil {
+		return stego.Header{}, nil, 0, err
+	}
+	if header.Length > uint64(r.Len()) {
+		return stego.Header{}, nil, 0, fmt.Errorf("%w: data length %d is larger than the chunk", stego.ErrCorrupted, header.Length)
+	}
+
+	data := make([]byte, header.Length)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return stego.Header{}, nil, 0, fmt.Errorf("failed to read hidden data: %w", err)
+	}
+
+	return verifyPayload(header, data)
+}
+
+// verifyPayload fixes any errors it can if the data has error correction, and then
+// checks the data against the header's checksum. It also returns the number of bytes
+// that were fixed
+func verifyPayload(header stego.Header, data []byte) (stego.Header, []byte, int, error) {
+	corrected := 0
+	if header.Parity != 0 {
+		var err error
+		data, corrected, err = stego.DecodeECC(data, header.Parity)
+		if err != nil {
+			return stego.Header{}, nil, 0, err
+		}
+		header.Length = uint64(len(data))
+	}
+
+	err := header.Verify(data)
+	if err != nil {
+		return stego.Header{}, nil, 0, err
+	}
+
+	return header, data, corrected, nil
+}
+
+// layouts returns every layout the hide command can use with the given key and image
+// format and stride, starting with the default
+func layouts(key string, format stego.Format, stride int) []stego.Layout {
+	all := []stego.Layout{{Channels: stego.RGB, Key: key, Format: format, Stride: stride}}
+	// hide always uses the default layout for gray and paletted images
+	if format.Single() {
+		return all
+	}
+
+	for _, transparent := range []bool{false, true} {
+		for channels := stego.Red; channels <= stego.RGBA; channels++ {
+			layout := stego.Layout{Channels: channels, Transparent: transparent, Key: key, Format: format, Stride: stride}
+			if layout != all[0] {
+				all = append(all, layout)
+			}
+		}
+	}
+
+	return all
+}
+
+// readPrivateKey reads a PEM encoded X25519 private key written by the keygen command
+func readPrivateKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	key, err := stego.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key file '%s': %w", path, err)
+	}
+
+	return key, nil
+}
+
+// decodeData undoes the encryption and compression applied by the hide command and
+// unwraps the envelope. Data hidden without an envelope is returned on its own
+func decodeData(header stego.Header, data []byte, options findOptions) (stego.Envelope, error) {
+	var err error
+	switch {
+	case header.Flags&stego.FlagEncrypted == 0:
+	case header.Ephemeral != nil:
+		data, err = stego.OpenWith(header, options.privateKey, data)
+	default:
+		data, err = stego.Open(header, options.password, data)
+	}
+	if err != nil {
+		return stego.Envelope{}, err
+	}
+
+	if header.Flags&stego.FlagCompressed != 0 {
+		data, err = stego.Decompress(data)
+		if err != nil {
+			return stego.Envelope{}, err
+		}
+	}
+
+	if header.Flags&stego.FlagEnvelope == 0 {
+		return stego.Envelope{Data: data}, nil
+	}
+
+	var envelope stego.Envelope
+	err = envelope.UnmarshalBinary(data)
+	if err != nil {
+		return stego.Envelope{}, fmt.Errorf("failed to decode envelope: %w", err)
+	}
+	envelope.Archive = header.Flags&stego.FlagArchive != 0
+
+	return envelope, nil
+}
+
+// printInfo prints the information stored in the envelope about the hidden file
+func printInfo(envelope stego.Envelope) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	if envelope.Name != "" {
+		fmt.Fprintf(w, "name:\t%s\n", envelope.Name)
+	}
+	fmt.Fprintf(w, "size:\t%d bytes\n", len(envelope.Data))
+	if envelope.Mode != 0 {
+		fmt.Fprintf(w, "mode:\t%s\n", envelope.Mode)
+	}
+	if !envelope.ModTime.IsZero() {
+		fmt.Fprintf(w, "modified:\t%s\n", envelope.ModTime.Format(time.RFC3339))
+	}
+	if envelope.MIME != "" {
+		fmt.Fprintf(w, "type:\t%s\n", envelope.MIME)
+	}
+	w.Flush()
+}
+
+// printArchive lists every file in a hidden archive along with its mode, size and
+// modification time
+func printArchive(data []byte) error {
+	headers, err := stego.ListArchive(data)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, header := range headers {
+		info := header.FileInfo()
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", info.Mode(), info.Size(), info.ModTime().Format(time.RFC3339), header.Name)
+	}
+
+	return w.Flush()
+}
+
+// restoreFile writes the hidden file into dir using its original name, mode and
+// modification time. Existing files are never overwritten
+func restoreFile(dir string, envelope stego.Envelope) error {
+	name := filepath.Base(envelope.Name)
+	if envelope.Name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return fmt.Errorf("hidden data does not have a valid file name: '%s'", envelope.Name)
 	}
 
-	number, err := bits.ToUint16(magic)
+	err := os.MkdirAll(dir, 0o755)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode magic number: %w", err)
+		return fmt.Errorf("failed to create output directory: %w", err)
 	}
-	if number != hide.MagicNumber {
-		return nil, errors.New("magic number does not match")
+
+	path := filepath.Join(dir, name)
+	mode := envelope.Mode
+	if mode == 0 {
+		mode = 0o644
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
 	}
 
-	// get the size of the message
-	var size []bool
-	for i := 16; i < 32; i++ {
-		size = append(size, image.Pix[i]&0x01 == 1)
+	_, err = f.Write(envelope.Data)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write output file: %w", err)
 	}
 
-	dataLen, err := bits.ToUint16(size)
+	err = f.Close()
 	if err != nil {
-		return nil, errors.New("failed to get data length")
+		return fmt.Errorf("failed to write output file: %w", err)
 	}
 
-	// now get the hidden data from the lowest bits
-	data := []bool{}
-	for i := 32; i < int(dataLen*8)+32; i++ {
-		data = append(data, image.Pix[i]&0x01 == 1)
+	if !envelope.ModTime.IsZero() {
+		err = os.Chtimes(path, envelope.ModTime, envelope.ModTime)
+		if err != nil {
+			return fmt.Errorf("failed to set modification time: %w", err)
+		}
 	}
 
-	return bits.ToBytes(data)
+	return nil
 }
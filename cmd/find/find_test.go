@@ -1,15 +1,28 @@
 package find
 
 import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
 	"image"
 	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/bjatkin/imgdemo/stego"
 )
 
 func Test_findData(t *testing.T) {
 	type args struct {
-		image *image.NRGBA
+		image   *image.NRGBA
+		options findOptions
 	}
 	tests := []struct {
 		name    string
@@ -20,7 +33,74 @@ func Test_findData(t *testing.T) {
 		{
 			name: "find data",
 			args: args{
-				image: newTestImage([...]color.NRGBA{
+				image: newTestImage([]color.NRGBA{
+					{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC1, 0xD0},
+					{0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0},
+					{0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0},
+					{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				}),
+			},
+			wantErr: false,
+			want:    []byte{0b1101_0001, 0b0001_1001},
+		},
+		{
+			name: "find data around transparent pixels",
+			args: args{
+				image: newTestImage([]color.NRGBA{
+					{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0x00}, {0xA0, 0xB0, 0xC0, 0x00}, {0xA0, 0xB0, 0xC0, 0x00}, {0xA0, 0xB0, 0xC0, 0x00},
+					{0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0},
+					{0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0},
+					{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				}),
+			},
+			wantErr: false,
+			want:    []byte{0b1101_0001, 0b0001_1001},
+		},
+		{
+			name: "corrupted data",
+			args: args{
+				image: newTestImage([]color.NRGBA{
+					{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC1, 0xD0},
+					{0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0},
+					{0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0},
+					{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				}),
+			},
+			wantErr: true,
+			want:    nil,
+		},
+		{
+			name: "find legacy data",
+			args: args{
+				image: newTestImage([]color.NRGBA{
 					{0xA0, 0xB0, 0xC0, 0xD1}, {0xA0, 0xB0, 0xC1, 0xD1}, {0xA0, 0xB0, 0xC1, 0xD1}, {0xA0, 0xB1, 0xC1, 0xD1},
 					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
 					{0xA1, 0xB1, 0xC0, 0xD1}, {0xA0, 0xB0, 0xC0, 0xD1}, {0xA0, 0xB0, 0xC0, 0xD1}, {0xA1, 0xB0, 0xC0, 0xD1},
@@ -33,7 +113,7 @@ func Test_findData(t *testing.T) {
 		{
 			name: "missing magic number",
 			args: args{
-				image: newTestImage([...]color.NRGBA{
+				image: newTestImage([]color.NRGBA{
 					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
 					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
 					{0xA1, 0xB1, 0xC0, 0xD1}, {0xA0, 0xB0, 0xC0, 0xD1}, {0xA0, 0xB0, 0xC0, 0xD1}, {0xA1, 0xB0, 0xC0, 0xD1},
@@ -46,25 +126,394 @@ func Test_findData(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := findData(tt.args.image)
+			got, _, err := findData([]image.Image{tt.args.image}, tt.args.options)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("FindData(): want error %v got error %v", tt.wantErr, err)
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !reflect.DeepEqual(got.Data, tt.want) {
 				t.Errorf("FindData(): retrived messages do not match")
 			}
 		})
 	}
 }
 
-func newTestImage(colors [16]color.NRGBA) *image.NRGBA {
-	shape := 4
-	img := image.NewNRGBA(image.Rect(0, 0, shape, shape))
-	for y := 0; y < shape; y++ {
-		for x := 0; x < shape; x++ {
-			img.Set(x, y, colors[x+y*shape])
+func Test_findDataCorrected(t *testing.T) {
+	want := []byte("Here's the hidden data, it can survive a few damaged pixels")
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{0xA0, 0xB0, 0xC0, 0xFF}), image.Point{}, draw.Src)
+
+	header := stego.Header{Version: stego.Version, Depth: 1, Channels: stego.RGB, Parity: 16}
+	header.SetChecksum(want)
+	payload, err := stego.EncodeECC(want, header.Parity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Length = uint64(len(payload))
+	headerData, err := header.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := stego.NewWriter(img.Pix, stego.Layout{Channels: stego.RGB})
+	_, err = w.Write(append(headerData, payload...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// damage a pixel in the header and a few in the data
+	for _, p := range []image.Point{{1, 0}, {20, 1}, {5, 9}, {6, 9}, {7, 9}} {
+		img.Set(p.X, p.Y, color.NRGBA{0x80, 0x80, 0x80, 0xFF})
+	}
+
+	got, corrected, err := findData([]image.Image{img}, findOptions{})
+	if err != nil {
+		t.Fatalf("FindData(): unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(got.Data, want) {
+		t.Errorf("FindData(): retrived messages do not match")
+	}
+	if corrected == 0 {
+		t.Errorf("FindData(): expected errors to be corrected")
+	}
+}
+
+func Test_readImage(t *testing.T) {
+	want := newTestImage([]color.NRGBA{
+		{0x10, 0x21, 0x30, 0xFF}, {0x11, 0x20, 0x31, 0xFF}, {0x10, 0x21, 0x30, 0xFF}, {0x00, 0x00, 0x00, 0x00},
+	})
+	tests := []struct {
+		name    string
+		image   draw.Image
+		encode  func(w io.Writer, img image.Image) error
+		wantErr error
+	}{
+		{name: "rgba", image: image.NewRGBA(want.Bounds()), encode: png.Encode},
+		{name: "multiple scan jpeg", image: image.NewRGBA(want.Bounds()), encode: func(w io.Writer, img image.Image) error {
+			var buf bytes.Buffer
+			err := jpeg.Encode(&buf, img, nil)
+			if err != nil {
+				return err
+			}
+
+			// repeat the scan, which still decodes but is not a jpeg data can be hidden in
+			data := buf.Bytes()
+			scan := data[bytes.Index(data, []byte{0xFF, 0xDA}) : len(data)-2]
+			_, err = w.Write(append(append(data[:len(data)-2:len(data)-2], scan...), 0xFF, 0xD9))
+			return err
+		}, wantErr: errNotBaseline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draw.Draw(tt.image, want.Bounds(), want, image.Point{}, draw.Src)
+			path := filepath.Join(t.TempDir(), tt.name)
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tt.encode(f, tt.image)
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readImage(path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("readImage(): want error %v got error %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("readImage() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_findDataPaletted(t *testing.T) {
+	want := []byte("Here's the hidden data")
+	header := stego.Header{Version: stego.Version, Depth: 1, Channels: stego.RGB, Length: uint64(len(want))}
+	headerData, err := header.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	palette := color.Palette{}
+	for i := 0; i < 16; i++ {
+		palette = append(palette, color.NRGBA{uint8(i * 16), uint8(255 - i*16), 0x80, 0xFF})
+	}
+	img := image.NewPaletted(image.Rect(0, 0, 32, 32), palette)
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i % 16)
+	}
+
+	// hide the data in a truecolor copy of the image too, with few enough colors
+	// that it can be saved with a palette afterwards
+	resaved := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(resaved, resaved.Bounds(), image.NewUniform(color.NRGBA{0xA0, 0xB0, 0xC0, 0xFF}), image.Point{}, draw.Src)
+	w := stego.NewWriter(resaved.Pix, stego.Layout{Channels: stego.RGB})
+	_, err = w.Write(append(headerData, want...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resavedPalette := color.Palette{}
+	for _, r := range []uint8{0xA0, 0xA1} {
+		for _, g := range []uint8{0xB0, 0xB1} {
+			for _, b := range []uint8{0xC0, 0xC1} {
+				resavedPalette = append(resavedPalette, color.NRGBA{r, g, b, 0xFF})
+			}
+		}
+	}
+	resavedImg := image.NewPaletted(resaved.Bounds(), resavedPalette)
+	draw.Draw(resavedImg, resaved.Bounds(), resaved, image.Point{}, draw.Src)
+
+	pix, format, err := stego.Pixels(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = stego.NewWriter(pix, stego.Layout{Channels: stego.RGB, Format: format})
+	_, err = w.Write(append(headerData, want...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stego.SetPixels(img, pix)
+
+	for _, img := range []*image.Paletted{img, resavedImg} {
+		got, _, err := findData([]image.Image{img}, findOptions{})
+		if err != nil {
+			t.Fatalf("FindData(): unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(got.Data, want) {
+			t.Errorf("FindData(): retrived messages do not match")
+		}
+	}
+}
+
+func Test_findDataChunk(t *testing.T) {
+	want := []byte("Here's the hidden data")
+	header := stego.Header{Version: stego.Version, Depth: 1, Channels: stego.RGB, Length: uint64(len(want))}
+	header.SetChecksum(want)
+	headerData, err := header.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pixels hold different data, which is only used when there is no chunk
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{0xA0, 0xB0, 0xC0, 0xFF}), image.Point{}, draw.Src)
+	other := []byte("Some other hidden data")
+	otherHeader := stego.Header{Version: stego.Version, Depth: 1, Channels: stego.RGB, Length: uint64(len(other))}
+	otherData, err := otherHeader.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := stego.NewWriter(img.Pix, stego.Layout{Channels: stego.RGB})
+	_, err = w.Write(append(otherData, other...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := append(bytes.Clone(headerData), want...)
+	corrupted[len(corrupted)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		chunk   []byte
+		want    []byte
+		wantErr error
+	}{
+		{name: "chunk", chunk: append(bytes.Clone(headerData), want...), want: want},
+		{name: "no payload in chunk", chunk: bytes.Repeat([]byte("not a header"), 8), want: other},
+		{name: "truncated chunk", chunk: headerData[:len(headerData)-1], wantErr: stego.ErrCorrupted},
+		{name: "corrupted chunk", chunk: corrupted, wantErr: stego.ErrCorrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := findData([]image.Image{&chunkImage{Image: img, chunk: tt.chunk}}, findOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FindData(): want error %v got error %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.Data, tt.want) {
+				t.Errorf("FindData() = %q, want %q", got.Data, tt.want)
+			}
+		})
+	}
+}
+
+// newTestImage creates an image that is 4 pixels wide and as tall as needed to fit colors
+func newTestImage(colors []color.NRGBA) *image.NRGBA {
+	width := 4
+	height := len(colors) / width
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, colors[x+y*width])
 		}
 	}
 
 	return img
 }
+
+func Test_decodeDataRecipient(t *testing.T) {
+	want := []byte("Here's the hidden data")
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() unexpected error %v", err)
+	}
+
+	header := stego.Header{Version: stego.Version, Depth: 1, Channels: stego.RGB}
+	sealed, err := stego.SealFor(&header, []*ecdh.PublicKey{key.PublicKey()}, want)
+	if err != nil {
+		t.Fatalf("SealFor() unexpected error %v", err)
+	}
+
+	got, err := decodeData(header, sealed, findOptions{privateKey: key})
+	if err != nil {
+		t.Fatalf("decodeData() unexpected error %v", err)
+	}
+	if !bytes.Equal(got.Data, want) {
+		t.Errorf("decodeData() = %q, want %q", got.Data, want)
+	}
+
+	// a password does not help with data encrypted for a recipient
+	_, err = decodeData(header, sealed, findOptions{password: "hunter2"})
+	if !errors.Is(err, stego.ErrKeyRequired) {
+		t.Errorf("decodeData() error = %v, want %v", err, stego.ErrKeyRequired)
+	}
+}
+
+func Test_findDataLossy(t *testing.T) {
+	// a plain baseline jpeg, like a stego png that was saved as a jpeg. It needs some
+	// detail so there are enough coefficients to hold a header
+	src := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 37 % 251)
+	}
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := stego.DecodeJPEG(&buf)
+	if err != nil {
+		t.Fatalf("DecodeJPEG() unexpected error %v", err)
+	}
+
+	_, _, err = findData([]image.Image{img}, findOptions{})
+	if !errors.Is(err, errLossy) || !errors.Is(err, stego.ErrNoPayload) {
+		t.Errorf("FindData(): want error %v got error %v", errLossy, err)
+	}
+}
+
+func Test_findDataErasure(t *testing.T) {
+	want := []byte("Here's the hidden data, any three of the five images are enough to find it")
+	shards, err := stego.EncodeErasure(want, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images := make([]image.Image, len(shards))
+	for i, shard := range shards {
+		header := stego.Header{
+			Version:  stego.Version,
+			Depth:    1,
+			Channels: stego.RGB,
+			Shard:    stego.Shard{Set: 7, Index: uint64(i), Total: 5, Need: 3, Size: uint64(len(want))},
+		}
+		images[i] = newShardImage(t, header, shard)
+	}
+
+	// damage the header of the second image, and add an image from another set
+	damaged := images[1].(*image.NRGBA)
+	for x := 0; x < 8; x++ {
+		damaged.Set(x, 0, color.NRGBA{0x80, 0x80, 0x80, 0xFF})
+	}
+	foreign := newShardImage(t, stego.Header{
+		Version:  stego.Version,
+		Depth:    1,
+		Channels: stego.RGB,
+		Shard:    stego.Shard{Set: 8, Index: 0, Total: 5, Need: 3, Size: uint64(len(want))},
+	}, shards[0])
+
+	got, _, err := findData([]image.Image{images[4], images[1], foreign, images[0], images[2]}, findOptions{})
+	if err != nil {
+		t.Fatalf("FindData(): unexpected error %v", err)
+	}
+	if !bytes.Equal(got.Data, want) {
+		t.Errorf("FindData() = %q, want %q", got.Data, want)
+	}
+
+	// with the damaged image there are only two good shards left
+	_, _, err = findData([]image.Image{images[4], images[1], foreign, images[0]}, findOptions{})
+	if !errors.Is(err, stego.ErrMissingShards) {
+		t.Errorf("FindData(): want error %v got error %v", stego.ErrMissingShards, err)
+	}
+}
+
+// newShardImage returns an image with the shard hidden in it the same way the hide
+// command would
+func newShardImage(t *testing.T, header stego.Header, shard []byte) *image.NRGBA {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{0xA0, 0xB0, 0xC0, 0xFF}), image.Point{}, draw.Src)
+
+	header.SetChecksum(shard)
+	header.Length = uint64(len(shard))
+	headerData, err := header.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := stego.NewWriter(img.Pix, stego.Layout{Channels: stego.RGB})
+	_, err = w.Write(append(headerData, shard...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+func Test_searchPayloadSkipsBadLength(t *testing.T) {
+	want := []byte("Here's the hidden data")
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{0xA0, 0xB0, 0xC0, 0xFF}), image.Point{}, draw.Src)
+
+	// a header in the default layout that claims more data than the image can hold
+	bad := stego.Header{Version: stego.Version, Depth: 1, Channels: stego.RGB, Length: 1 << 20}
+	badData, err := bad.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stego.NewWriter(img.Pix, stego.Layout{Channels: stego.RGB}).Write(badData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the real data is in the alpha channel, which the default layout doesn't touch
+	header := stego.Header{Version: stego.Version, Depth: 1, Channels: stego.Alpha, Length: uint64(len(want))}
+	header.SetChecksum(want)
+	headerData, err := header.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stego.NewWriter(img.Pix, stego.Layout{Channels: stego.Alpha}).Write(append(headerData, want...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, got, _, err := searchPayload(img, "")
+	if err != nil {
+		t.Fatalf("searchPayload(): unexpected error %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("searchPayload(): got %q, want %q", got, want)
+	}
+}
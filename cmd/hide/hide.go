@@ -1,35 +1,77 @@
 package hide
 
 import (
+	"bytes"
+	"crypto/ecdh"
 	"errors"
+	"flag"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
-	_ "image/gif"
+	"image/gif"
 	_ "image/jpeg"
 	"image/png"
+	"io"
+	"math"
+	"mime"
 	"os"
+	"path/filepath"
 	"strings"
 
-	"github.com/bjatkin/imgdemo/bits"
 	"github.com/bjatkin/imgdemo/cli"
+	"github.com/bjatkin/imgdemo/pngchunk"
+	"github.com/bjatkin/imgdemo/stego"
 )
 
-// MagicNumber is the magic number that indicates that there is data hidden in this image
-var MagicNumber uint16 = 0x1337
-
 // hideArgs are the arguments for the hide command
 type hideArgs struct {
-	inputPath  string
-	dataPath   string
-	outputPath string
+	inputPath      string
+	dataPaths      []string
+	outputPath     string
+	recipientPaths []string
+	options        hideOptions
+}
+
+// hideOptions control how data is hidden inside the image
+type hideOptions struct {
+	depth       int
+	channels    stego.Channels
+	transparent bool
+	password    string
+	passwordKey *stego.PasswordKey
+	recipients  []*ecdh.PublicKey
+	key         string
+	compress    string
+	mime        string
+	shard       bool
+	need        int
+	parity      uint8
+	matching    bool
+	texture     int
+	matrix      int
+	mode        string
+	strip       bool
 }
 
+// compression settings for the hide command
+const (
+	compressNever  = "never"
+	compressAlways = "always"
+	compressAuto   = "auto"
+)
+
+// embedding modes for the hide command
+const (
+	modeLSB   = "lsb"
+	modeChunk = "chunk"
+)
+
 // Cmd is the hide command that hides data in the least significant bit of the given image.
 // it will then write a new 'png' image to the output file path with that hidden data.
 var Cmd = &cli.Cmd[hideArgs]{
 	Name:        "hide",
-	Usage:       "hide [INPUT IMAGE PATH] [DATA FILE PATH] [OUTPUT IMAGE PATH]",
+	Usage:       "hide [-depth 1-4] [-channels rgba] [-transparent] [-matching] [-matrix BITS] [-adaptive SCORE] [-mode lsb|chunk] [-password PASSWORD] [-recipient PUBLIC KEY PATH...] [-key KEY] [-compress auto|always|never] [-mime TYPE] [-shard] [-need COUNT] [-ecc none|low|medium|high] [-strip] [INPUT IMAGE PATH] [DATA PATH...] [OUTPUT IMAGE PATH]",
 	Description: "hide data inside an image using steganography",
 	Examples: []cli.Example{
 		{
@@ -37,78 +79,853 @@ var Cmd = &cli.Cmd[hideArgs]{
 			Args:        []string{"src.jpeg", "secret.dat", "img.png"},
 		},
 		{
-			Description: "only png files are supported as output files",
+			Description: "hide 'config.yml', 'id.key' and the 'docs' directory together in 'img.png'",
+			Args:        []string{"src.jpeg", "config.yml", "id.key", "docs", "img.png"},
+		},
+		{
+			Description: "use the lowest 2 bits of each sample to fit more data in 'img.png'",
+			Args:        []string{"-depth", "2", "src.jpeg", "secret.dat", "img.png"},
+		},
+		{
+			Description: "hide data only in the alpha channel of 'img.png'",
+			Args:        []string{"-channels", "a", "src.png", "secret.dat", "img.png"},
+		},
+		{
+			Description: "use LSB matching so the data in 'img.png' is harder to detect",
+			Args:        []string{"-matching", "src.jpeg", "secret.dat", "img.png"},
+		},
+		{
+			Description: "hide 3 bits in every 7 samples so fewer samples in 'img.png' are changed",
+			Args:        []string{"-matrix", "3", "src.jpeg", "secret.dat", "img.png"},
+		},
+		{
+			Description: "only hide data in the busiest parts of 'img.png' where it's hardest to detect",
+			Args:        []string{"-adaptive", "4", "src.jpeg", "secret.dat", "img.png"},
+		},
+		{
+			Description: "store the data in a private chunk of 'img.png' so no pixels are changed",
+			Args:        []string{"-mode", "chunk", "src.png", "secret.dat", "img.png"},
+		},
+		{
+			Description: "encrypt the data in 'img.png' so it can only be read with the password",
+			Args:        []string{"-password", "hunter2", "src.jpeg", "secret.dat", "img.png"},
+		},
+		{
+			Description: "encrypt the data in 'img.png' so only the owners of the private keys for 'alice.pub' and 'bob.pub' can read it",
+			Args:        []string{"-recipient", "alice.pub", "-recipient", "bob.pub", "src.jpeg", "secret.dat", "img.png"},
+		},
+		{
+			Description: "scatter the data over all of 'img.png' in an order that can only be found with the key",
+			Args:        []string{"-key", "correct-horse", "src.jpeg", "secret.dat", "img.png"},
+		},
+		{
+			Description: "add error correction so the data in 'img.png' survives a few damaged pixels",
+			Args:        []string{"-ecc", "medium", "src.jpeg", "secret.dat", "img.png"},
+		},
+		{
+			Description: "split the data across every image in 'covers' and write them to the 'out' directory",
+			Args:        []string{"-shard", "covers/*.jpeg", "secret.dat", "out"},
+		},
+		{
+			Description: "split the data across 'a.jpeg' and 'b.jpeg'",
+			Args:        []string{"-shard", "a.jpeg,b.jpeg", "secret.dat", "out"},
+		},
+		{
+			Description: "split the data across 5 images so that any 3 of them are enough to find it",
+			Args:        []string{"-shard", "-need", "3", "covers/*.jpeg", "secret.dat", "out"},
+		},
+		{
+			Description: "leave out the color profile, text and other metadata that is otherwise copied from 'src.png'",
+			Args:        []string{"-strip", "src.png", "secret.dat", "img.png"},
+		},
+		{
+			Description: "hide data in a gif, keeping its palette by only swapping pixels between similar colors. Animated gifs use every frame",
+			Args:        []string{"src.gif", "secret.dat", "img.gif"},
+		},
+		{
+			Description: "hide data in the DCT coefficients of a baseline jpeg so it survives being written as a jpeg",
 			Args:        []string{"src.jpeg", "secret.dat", "img.jpeg"},
-			Error:       errors.New("png is the only supported output image format"),
+		},
+		{
+			Description: "only png, gif and jpeg files are supported as output files",
+			Args:        []string{"src.jpeg", "secret.dat", "img.bmp"},
+			Error:       errors.New("png, gif and jpeg are the only supported output image formats"),
 		},
 	},
 	ParseArgs: func(args []string) (hideArgs, error) {
-		if len(args) != 3 {
-			return hideArgs{}, errors.New("expected exactly 3 arguments")
+		var options hideOptions
+		flags := flag.NewFlagSet("hide", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.IntVar(&options.depth, "depth", 1, "number of low bits to use in each sample")
+		channels := flags.String("channels", "rgb", "color channels to hide data in")
+		flags.BoolVar(&options.transparent, "transparent", false, "also hide data in fully transparent pixels")
+		flags.BoolVar(&options.matching, "matching", false, "change samples by adding or subtracting 1 instead of replacing their low bits, which is harder to detect")
+		flags.IntVar(&options.matrix, "matrix", 0, "use matrix embedding to hide BITS bits in every 2^BITS-1 samples while changing at most one of them")
+		flags.IntVar(&options.texture, "adaptive", 0, "only hide data in pixels with at least this texture score, higher scores use busier parts of the image")
+		flags.StringVar(&options.mode, "mode", modeLSB, "lsb hides data in the pixels, chunk stores it in a png chunk without changing any pixels")
+		flags.StringVar(&options.password, "password", "", "encrypt the data using this password")
+		var recipientPaths []string
+		flags.Func("recipient", "encrypt the data for the public key in this PEM file, can be given more than once", func(path string) error {
+			recipientPaths = append(recipientPaths, path)
+			return nil
+		})
+		flags.StringVar(&options.key, "key", "", "scatter the data over the image using this key")
+		flags.StringVar(&options.compress, "compress", compressAuto, "compress the data, auto only compresses data that would not fit otherwise")
+		flags.StringVar(&options.mime, "mime", "", "MIME type of the data file, by default it's guessed from the file extension")
+		ecc := flags.String("ecc", "none", "error correction level, higher levels fix more damage but leave less room for data")
+		flags.IntVar(&options.need, "need", 0, "with -shard, add redundancy so any COUNT of the images are enough to find the data")
+		flags.BoolVar(&options.strip, "strip", false, "do not copy metadata like gAMA, iCCP, pHYs or tEXt chunks from the input png")
+		flags.BoolVar(&options.shard, "shard", false, "split the data across a comma separated list or glob of input images, and write them to an output directory")
+		err := flags.Parse(args)
+		if err != nil {
+			return hideArgs{}, err
+		}
+		args = flags.Args()
+
+		if options.password != "" && len(recipientPaths) > 0 {
+			return hideArgs{}, errors.New("password and recipient can not be used together")
+		}
+
+		options.channels, err = stego.ParseChannels(*channels)
+		if err != nil {
+			return hideArgs{}, err
+		}
+
+		// matching can change the high bits of the alpha channel, which decide which
+		// pixels are skipped as transparent
+		if options.matching && options.channels&stego.Alpha != 0 && !options.transparent {
+			return hideArgs{}, errors.New("matching can not be used with the alpha channel unless transparent pixels are used too")
+		}
+
+		if options.texture < 0 || options.texture > stego.MaxTexture {
+			return hideArgs{}, fmt.Errorf("adaptive score must be between 0 and %d", stego.MaxTexture)
+		}
+
+		// the texture score is worked out from the high bits of each sample, which
+		// matching can change
+		if options.matching && options.texture != 0 {
+			return hideArgs{}, errors.New("matching can not be used with adaptive")
+		}
+
+		if options.matrix != 0 && (options.matrix < 2 || options.matrix > stego.MaxMatrix) {
+			return hideArgs{}, fmt.Errorf("matrix must be between 2 and %d bits", stego.MaxMatrix)
+		}
+		if options.matrix != 0 && options.depth != 1 {
+			return hideArgs{}, errors.New("matrix can only be used with a depth of 1")
+		}
+
+		options.parity, err = stego.ParseECC(*ecc)
+		if err != nil {
+			return hideArgs{}, err
+		}
+
+		switch options.compress {
+		case compressNever, compressAlways, compressAuto:
+		default:
+			return hideArgs{}, fmt.Errorf("compress must be one of %s, %s or %s", compressAuto, compressAlways, compressNever)
+		}
+
+		switch options.mode {
+		case modeLSB:
+		case modeChunk:
+			// no pixels are changed so there are no samples to pick
+			if options.depth != 1 || options.channels != stego.RGB || options.transparent || options.matching ||
+				options.matrix != 0 || options.texture != 0 || options.key != "" {
+				return hideArgs{}, errors.New("depth, channels, transparent, matching, matrix, adaptive and key can not be used with chunk mode")
+			}
+			if options.shard {
+				return hideArgs{}, errors.New("shard can not be used with chunk mode")
+			}
+		default:
+			return hideArgs{}, fmt.Errorf("mode must be either %s or %s", modeLSB, modeChunk)
+		}
+
+		if options.depth < 1 || options.depth > stego.MaxDepth {
+			return hideArgs{}, fmt.Errorf("depth must be between 1 and %d", stego.MaxDepth)
+		}
+
+		if options.need != 0 && !options.shard {
+			return hideArgs{}, errors.New("need can only be used with shard")
 		}
 
-		if !strings.HasSuffix(args[2], ".png") {
-			return hideArgs{}, errors.New("png is the only supported output image format")
+		if len(args) < 3 {
+			return hideArgs{}, errors.New("expected an input image, at least one data path and an output image")
+		}
+
+		outputPath := args[len(args)-1]
+		if !options.shard && !strings.HasSuffix(outputPath, ".png") && !strings.HasSuffix(outputPath, ".gif") && !isJPEG(outputPath) {
+			return hideArgs{}, errors.New("png, gif and jpeg are the only supported output image formats")
+		}
+		if options.mode == modeChunk && !strings.HasSuffix(outputPath, ".png") {
+			return hideArgs{}, errors.New("chunk mode can only be used with a png output image")
 		}
 
 		return hideArgs{
-			inputPath:  args[0],
-			dataPath:   args[1],
-			outputPath: args[2],
+			inputPath:      args[0],
+			dataPaths:      args[1 : len(args)-1],
+			outputPath:     outputPath,
+			recipientPaths: recipientPaths,
+			options:        options,
 		}, nil
 	},
 	Fn: func(args hideArgs) error {
-		imageFile, err := os.Open(args.inputPath)
+		// the key is derived once since compressing the data may mean sealing it twice
+		if args.options.password != "" {
+			var err error
+			args.options.passwordKey, err = stego.NewPasswordKey(args.options.password)
+			if err != nil {
+				return fmt.Errorf("failed to derive key: %w", err)
+			}
+		}
+
+		for _, path := range args.recipientPaths {
+			recipient, err := readPublicKey(path)
+			if err != nil {
+				return err
+			}
+			args.options.recipients = append(args.options.recipients, recipient)
+		}
+
+		inputPaths := []string{args.inputPath}
+		outputPaths := []string{args.outputPath}
+		if args.options.shard {
+			var err error
+			inputPaths, err = expandPaths(args.inputPath)
+			if err != nil {
+				return err
+			}
+
+			outputPaths, err = shardOutputPaths(inputPaths, args.outputPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		images := make([]image.Image, len(inputPaths))
+		metadata := make([][]pngchunk.Chunk, len(inputPaths))
+		for i, path := range inputPaths {
+			var err error
+			if !args.options.strip {
+				metadata[i], err = readMetadata(path)
+				if err != nil {
+					return err
+				}
+			}
+
+			if isJPEG(outputPaths[i]) {
+				images[i], err = readJPEG(path)
+			} else {
+				images[i], err = readImage(path)
+			}
+			if err != nil {
+				return err
+			}
+
+			switch img := images[i].(type) {
+			case *image.Paletted:
+				if strings.HasSuffix(outputPaths[i], ".gif") {
+					padPalette(img)
+				}
+			case *stego.Animation:
+				for _, frame := range img.Image {
+					padPalette(frame)
+				}
+			}
+		}
+
+		data, err := readEnvelope(args.dataPaths, args.options.mime)
+		if err != nil {
+			return fmt.Errorf("failed to read in data to encode: %w", err)
+		}
+
+		var chunks []pngchunk.Chunk
+		if args.options.mode == modeChunk {
+			chunk, err := hideChunk(data, args.options)
+			if err != nil {
+				return fmt.Errorf("failed to hide data: %w", err)
+			}
+			chunks = append(chunks, chunk)
+		} else {
+			err = hideData(data, images, args.options)
+			if err != nil {
+				return fmt.Errorf("failed to hide data: %w", err)
+			}
+		}
+
+		for i, path := range outputPaths {
+			err = writeImage(path, images[i], append(metadata[i], chunks...))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+// readImage decodes the image at path. NRGBA, NRGBA64, Gray and Gray16 images keep
+// their color model and bit depth so the output looks like the input, any other image
+// is copied into an NRGBA image
+func readImage(path string) (image.Image, error) {
+	imageFile, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+	defer imageFile.Close()
+
+	img, format, err := image.Decode(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image file '%s': %w", path, err)
+	}
+
+	// data is hidden in every frame of an animated gif, not just the first one
+	if format == "gif" {
+		_, err = imageFile.Seek(0, io.SeekStart)
+		if err == nil {
+			img, err = stego.DecodeGIF(imageFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode gif file '%s': %w", path, err)
+		}
+	}
+
+	carrier, ok := stego.Carrier(img)
+	if ok {
+		return carrier, nil
+	}
+
+	// copy the incomming image into an NRGBA image to make it easy to work with
+	rgbaImg := image.NewNRGBA(img.Bounds())
+	draw.Draw(rgbaImg, img.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgbaImg, nil
+}
+
+// metadataChunks are the ancillary chunks copied from the input png to the output, so
+// it does not look re-processed and color managed viewers show the same colors. Other
+// chunks, like tRNS or bKGD, depend on the color type of the input which the output
+// may not share
+var metadataChunks = map[string]bool{
+	"gAMA": true,
+	"cHRM": true,
+	"iCCP": true,
+	"sRGB": true,
+	"pHYs": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// readPublicKey reads a PEM encoded X25519 public key written by the keygen command
+func readPublicKey(path string) (*ecdh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file: %w", err)
+	}
+
+	key, err := stego.ParsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key file '%s': %w", path, err)
+	}
+
+	return key, nil
+}
+
+// readMetadata returns the metadata chunks of the png at path, or nil if it's not a png
+func readMetadata(path string) ([]pngchunk.Chunk, error) {
+	imageFile, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+	defer imageFile.Close()
+
+	chunks, err := pngchunk.Read(imageFile)
+	if errors.Is(err, pngchunk.ErrNotPNG) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read png chunks from '%s': %w", path, err)
+	}
+
+	var metadata []pngchunk.Chunk
+	for _, chunk := range chunks {
+		if metadataChunks[chunk.Type] {
+			metadata = append(metadata, chunk)
+		}
+	}
+
+	return metadata, nil
+}
+
+// readJPEG reads the DCT coefficients of the baseline jpeg at path, data has to be
+// hidden in them rather than the pixels for it to survive being written as a jpeg
+func readJPEG(path string) (*stego.JPEG, error) {
+	imageFile, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+	defer imageFile.Close()
+
+	img, err := stego.DecodeJPEG(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("jpeg output needs a baseline jpeg input image, failed to read '%s': %w", path, err)
+	}
+
+	return img, nil
+}
+
+// isJPEG reports whether path has a jpeg file extension
+func isJPEG(path string) bool {
+	return strings.HasSuffix(path, ".jpg") || strings.HasSuffix(path, ".jpeg")
+}
+
+// writeImage encodes img as a png file at path, the png color type and bit depth
+// follow img's color model, and chunks are added to it. Paletted images
+// can also be written as a gif file, and animations can only be written as one. Jpegs
+// are always written as a jpeg with the coefficients data was hidden in
+func writeImage(path string, img image.Image, chunks []pngchunk.Chunk) error {
+	paletted, isPaletted := img.(*image.Paletted)
+	animation, isAnimation := img.(*stego.Animation)
+	jpeg, isJPEGImage := img.(*stego.JPEG)
+	isGIF := strings.HasSuffix(path, ".gif")
+	if isGIF && !isPaletted && !isAnimation {
+		return errors.New("gif output needs a gif or indexed png input image")
+	}
+	if isAnimation && !isGIF {
+		return errors.New("animated gifs can only be written as a gif")
+	}
+	if isJPEGImage != isJPEG(path) {
+		return errors.New("jpeg output needs a baseline jpeg input image")
+	}
+
+	fout, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to open destination file: %w", err)
+	}
+	defer fout.Close()
+
+	if isAnimation {
+		// the frame delays, disposal and loop count are all kept
+		err = gif.EncodeAll(fout, animation.GIF)
+		if err != nil {
+			return fmt.Errorf("failed to encode gif output image: %w", err)
+		}
+		return fout.Close()
+	}
+	if isJPEGImage {
+		// the quantization and huffman tables, and any metadata, are kept
+		err = jpeg.Coefficients.Encode(fout)
 		if err != nil {
-			return fmt.Errorf("failed to read image file: %w", err)
+			return fmt.Errorf("failed to encode jpeg output image: %w", err)
 		}
-		defer imageFile.Close()
+		return fout.Close()
+	}
+	if isGIF {
+		// the palette has at most 256 colors so the encoder uses it as it is
+		err = gif.Encode(fout, paletted, nil)
+		if err != nil {
+			return fmt.Errorf("failed to encode gif output image: %w", err)
+		}
+		return fout.Close()
+	}
+
+	err = encodePNG(fout, img, chunks)
+	if err != nil {
+		return fmt.Errorf("failed to encode png output image: %w", err)
+	}
+
+	return fout.Close()
+}
 
-		img, _, err := image.Decode(imageFile)
+// encodePNG writes img as a png with chunks added wherever the png spec allows them.
+// The png encoder has no way to add chunks, so they are added to its output
+func encodePNG(w io.Writer, img image.Image, chunks []pngchunk.Chunk) error {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return err
+	}
+
+	all, err := pngchunk.Read(&buf)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		all = pngchunk.Insert(all, chunk)
+	}
+
+	return pngchunk.Write(w, all)
+}
+
+// padPalette pads the palette of img with black to a power of 2 colors, the same way
+// the gif encoder does. Data is hidden using the order of the palette, so it has to be
+// the palette find will read back
+func padPalette(img *image.Paletted) {
+	size := 2
+	for size < len(img.Palette) {
+		size *= 2
+	}
+	for len(img.Palette) < size {
+		img.Palette = append(img.Palette, color.RGBA{0x00, 0x00, 0x00, 0xFF})
+	}
+}
+
+// expandPaths expands a comma separated list of paths and glob patterns, the paths
+// are returned in the order they were listed
+func expandPaths(list string) ([]string, error) {
+	var paths []string
+	for _, pattern := range strings.Split(list, ",") {
+		matches, err := filepath.Glob(pattern)
 		if err != nil {
-			return fmt.Errorf("failed to decode png file: %w", err)
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
 		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no images match '%s'", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+
+	return paths, nil
+}
+
+// shardOutputPaths returns the output path for every cover image, each one is written
+// to dir with the same base name as its cover. Gif covers are written as gifs and
+// everything else as a png
+func shardOutputPaths(inputPaths []string, dir string) ([]string, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
 
-		rawData, err := os.ReadFile(args.dataPath)
+	seen := map[string]bool{}
+	outputPaths := make([]string, len(inputPaths))
+	for i, path := range inputPaths {
+		ext := ".png"
+		if strings.EqualFold(filepath.Ext(path), ".gif") {
+			ext = ".gif"
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ext
+		if seen[name] {
+			return nil, fmt.Errorf("more than one cover image would be written to '%s'", name)
+		}
+		seen[name] = true
+		outputPaths[i] = filepath.Join(dir, name)
+	}
+
+	return outputPaths, nil
+}
+
+// readEnvelope reads the data to hide into an envelope. A single file is stored along
+// with its name, mode and modification time, if mimeType is empty it's guessed from the
+// file extension. Several files or a directory are packed into an archive instead
+func readEnvelope(paths []string, mimeType string) (stego.Envelope, error) {
+	info, err := os.Stat(paths[0])
+	if err != nil {
+		return stego.Envelope{}, err
+	}
+
+	if len(paths) > 1 || info.IsDir() {
+		data, err := stego.PackArchive(paths)
 		if err != nil {
-			return fmt.Errorf("failed to read in data to encode: %w", err)
+			return stego.Envelope{}, fmt.Errorf("failed to create archive: %w", err)
 		}
 
-		// copy the incomming image into an NRGBA image to make it easy to work with
-		rgbaImg := image.NewNRGBA(img.Bounds())
-		draw.Draw(rgbaImg, img.Bounds(), img, image.Pt(0, 0), draw.Src)
+		return stego.Envelope{
+			MIME:    stego.ArchiveMIME,
+			Data:    data,
+			Archive: true,
+		}, nil
+	}
+
+	path := paths[0]
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return stego.Envelope{}, err
+	}
+
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(path))
+	}
 
-		hideData(rawData, rgbaImg)
+	return stego.Envelope{
+		Name:    info.Name(),
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+		MIME:    mimeType,
+		Data:    data,
+	}, nil
+}
 
-		fout, err := os.Create(args.outputPath)
+// hideData takes images and an envelope, it then hides a header followed by the
+// envelope in the lowest bits of the selected channels in the image pixel data.
+// When there is more than one image the envelope is split across all of them
+func hideData(envelope stego.Envelope, images []image.Image, options hideOptions) error {
+	data, err := envelope.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode envelope: %w", err)
+	}
+
+	header := stego.Header{
+		Version:  stego.Version,
+		Flags:    stego.FlagEnvelope,
+		Depth:    uint8(options.depth),
+		Channels: options.channels,
+		Parity:   options.parity,
+		Texture:  uint8(options.texture),
+		Matrix:   uint8(options.matrix),
+	}
+	if options.transparent {
+		header.Flags |= stego.FlagTransparent
+	}
+	if options.key != "" {
+		header.Flags |= stego.FlagScattered
+	}
+	if envelope.Archive {
+		header.Flags |= stego.FlagArchive
+	}
+	if len(images) > 1 {
+		need := options.need
+		if need == 0 {
+			need = len(images)
+		}
+		header.Shard, err = stego.NewShardSet(len(images), need)
 		if err != nil {
-			return fmt.Errorf("failed to open destination file: %w", err)
+			return err
 		}
-		defer fout.Close()
+	}
+	layout := header.Layout(options.key)
 
-		err = png.Encode(fout, rgbaImg)
+	// the header is always hidden without checking texture, but it's small so counting
+	// only the textured samples is close enough
+	payloadLayout := layout
+	payloadLayout.Texture = header.Texture
+	pix := make([][]uint8, len(images))
+	formats := make([]stego.Format, len(images))
+	strides := make([]int, len(images))
+	samples := make([]int, len(images))
+	for i, image := range images {
+		pix[i], formats[i], err = stego.Pixels(image)
 		if err != nil {
-			return fmt.Errorf("failed to encode png output image: %w", err)
+			return err
 		}
+		strides[i] = stego.Stride(image)
 
-		return nil
-	},
+		// gray, paletted and jpeg images only have one kind of sample, so there are no
+		// channels to pick and no transparency to skip
+		if formats[i].Single() && (options.channels != stego.RGB || options.transparent) {
+			return errors.New("channels and transparent can not be used with gray, paletted or jpeg images")
+		}
+
+		// only the lowest bit of a paletted sample can change, anything more could
+		// swap to a color that has no partner in the palette
+		if formats[i] == stego.FormatPaletted && (options.depth != 1 || options.matching) {
+			return errors.New("paletted images only support a depth of 1 without matching")
+		}
+
+		// changing more than the lowest bit of a coefficient could change how it's
+		// compressed, and a jpeg has no pixels to score for texture
+		if formats[i] == stego.FormatJPEG && (options.depth != 1 || options.matching || options.texture != 0) {
+			return errors.New("jpeg images only support a depth of 1 without matching or adaptive")
+		}
+
+		payloadLayout.Format = formats[i]
+		payloadLayout.Stride = strides[i]
+		samples[i] = payloadLayout.Count(pix[i])
+	}
+
+	header, payload, err := encodeData(header, data, options.compress == compressAlways, options)
+	if err != nil {
+		return err
+	}
+
+	capacities, capacity := shardCapacities(header, samples)
+	if len(payload) > capacity && options.compress == compressAuto {
+		header, payload, err = encodeData(header, data, true, options)
+		if err != nil {
+			return err
+		}
+		capacities, capacity = shardCapacities(header, samples)
+	}
+	if len(payload) > capacity {
+		if len(images) > 1 {
+			return fmt.Errorf("data needs %d bytes but the images only have %d bytes available", len(payload), capacity)
+		}
+		return fmt.Errorf("data needs %d bytes but the image only has %d bytes available", len(payload), capacity)
+	}
+
+	shards, err := splitPayload(&header, payload, capacities)
+	if err != nil {
+		return err
+	}
+
+	for i, shard := range shards {
+		shardHeader := header
+		if len(images) > 1 {
+			shardHeader.Shard.Index = uint64(i)
+		}
+
+		layout.Format = formats[i]
+		layout.Stride = strides[i]
+		err = writePayload(pix[i], layout, shardHeader, shard, options.matching)
+		if err != nil {
+			return err
+		}
+		stego.SetPixels(images[i], pix[i])
+	}
+
+	return nil
 }
 
-// hideData takes an image and a set of data, it then hides that data in the lowest
-// bit of each bye in the image pixel data
-func hideData(data []byte, image *image.NRGBA) {
-	magicNumber := bits.FromUint16(MagicNumber)
-	messageSize := bits.FromUint16(uint16(len(data)))
-	messageData := bits.FromBytes(data)
-	bitData := append(magicNumber, messageSize...)
-	bitData = append(bitData, messageData...)
+// shardCapacities returns how many bytes of data can be hidden in each image along
+// with its header, and the total that can be hidden over every image
+func shardCapacities(header stego.Header, samples []int) ([]int, int) {
+	// the last shard index is used since it's the largest, and so has the largest
+	// header. The size is not known yet so the largest one an image could hold is used
+	if header.Shard.Total != 0 {
+		header.Shard.Index = header.Shard.Total - 1
+	}
+	if header.Shard.Need != 0 {
+		header.Shard.Size = math.MaxUint32
+	}
+	// framePayload always adds a checksum, which makes the header larger
+	header.Flags |= stego.FlagChecksum
 
-	for i, b := range bitData {
-		if b {
-			image.Pix[i] |= 0x01 // set the lowest bit to 1
-		} else {
-			image.Pix[i] &= 0xFE // set the lowest bit to 0
+	total := 0
+	capacities := make([]int, len(samples))
+	for i, count := range samples {
+		capacities[i] = header.Capacity(count)
+		total += capacities[i]
+	}
+	if header.Shard.Need != 0 {
+		total = stego.ErasureCapacity(capacities, int(header.Shard.Need))
+	}
+
+	return capacities, total
+}
+
+// splitPayload splits the payload into one shard for each capacity. Erasure coded
+// payloads also record their size in the header
+func splitPayload(header *stego.Header, payload []byte, capacities []int) ([][]byte, error) {
+	if header.Shard.Need == 0 {
+		return stego.SplitPayload(payload, capacities)
+	}
+
+	header.Shard.Size = uint64(len(payload))
+	return stego.EncodeErasure(payload, int(header.Shard.Need), int(header.Shard.Total))
+}
+
+// hideChunk stores the envelope in a png chunk rather than in the pixel data, so no
+// pixel is changed. A chunk has no size limit, so the data is only compressed when
+// compression is always on
+func hideChunk(envelope stego.Envelope, options hideOptions) (pngchunk.Chunk, error) {
+	data, err := envelope.MarshalBinary()
+	if err != nil {
+		return pngchunk.Chunk{}, fmt.Errorf("failed to encode envelope: %w", err)
+	}
+
+	header := stego.Header{
+		Version:  stego.Version,
+		Flags:    stego.FlagEnvelope,
+		Depth:    1,
+		Channels: stego.RGB,
+		Parity:   options.parity,
+	}
+	if envelope.Archive {
+		header.Flags |= stego.FlagArchive
+	}
+
+	header, payload, err := encodeData(header, data, options.compress == compressAlways, options)
+	if err != nil {
+		return pngchunk.Chunk{}, err
+	}
+
+	headerData, payload, err := framePayload(header, payload)
+	if err != nil {
+		return pngchunk.Chunk{}, err
+	}
+
+	return pngchunk.Chunk{Type: stego.ChunkType, Data: append(headerData, payload...)}, nil
+}
+
+// framePayload gives the header a checksum of the payload, and adds parity bytes to the
+// payload if the header asks for error correction. It returns the encoded header along
+// with the payload that follows it
+func framePayload(header stego.Header, payload []byte) ([]byte, []byte, error) {
+	header.SetChecksum(payload)
+	if header.Parity != 0 {
+		var err error
+		payload, err = stego.EncodeECC(payload, header.Parity)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to add error correction: %w", err)
 		}
 	}
+	header.Length = uint64(len(payload))
+
+	headerData, err := header.MarshalBinary()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode header: %w", err)
+	}
+
+	return headerData, payload, nil
+}
+
+// writePayload hides the header followed by the payload in the pixel data, see
+// framePayload. With matching, samples are changed using LSB matching rather than
+// having their low bits replaced
+func writePayload(pix []uint8, layout stego.Layout, header stego.Header, payload []byte, matching bool) error {
+	headerData, payload, err := framePayload(header, payload)
+	if err != nil {
+		return err
+	}
+
+	// the header is always hidden in the lowest bit so find can read it before it
+	// knows the depth used for the data
+	w := stego.NewWriter(pix, layout)
+	w.Matching = matching
+	_, err = w.Write(headerData)
+	if err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	w.Depth = int(header.Depth)
+	w.Matrix = int(header.Matrix)
+	w.SetTexture(header.Texture)
+	_, err = w.Write(payload)
+	if err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+
+	return w.Flush()
+}
+
+// encodeData prepares data to be hidden by compressing and then encrypting it with
+// the password or for the recipients in options. It returns the payload to hide and
+// the header describing it
+func encodeData(header stego.Header, data []byte, compress bool, options hideOptions) (stego.Header, []byte, error) {
+	header.Flags &^= stego.FlagCompressed | stego.FlagEncrypted | stego.FlagChecksum
+
+	var err error
+	if compress {
+		data, err = stego.Compress(data)
+		if err != nil {
+			return stego.Header{}, nil, err
+		}
+		header.Flags |= stego.FlagCompressed
+	}
+
+	switch {
+	case options.passwordKey != nil:
+		data, err = options.passwordKey.Seal(&header, data)
+		if err != nil {
+			return stego.Header{}, nil, fmt.Errorf("failed to encrypt data: %w", err)
+		}
+	case len(options.recipients) > 0:
+		data, err = stego.SealFor(&header, options.recipients, data)
+		if err != nil {
+			return stego.Header{}, nil, fmt.Errorf("failed to encrypt data: %w", err)
+		}
+	}
+
+	return header, data, nil
 }
@@ -1,44 +1,132 @@
 package hide
 
 import (
+	"bytes"
 	"image"
 	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/bjatkin/imgdemo/pngchunk"
+	"github.com/bjatkin/imgdemo/stego"
 )
 
 func Test_hideData(t *testing.T) {
 	type args struct {
-		data  []byte
-		image *image.NRGBA
+		data    stego.Envelope
+		image   *image.NRGBA
+		options hideOptions
 	}
 	tests := []struct {
-		name string
-		args args
-		want *image.NRGBA
+		name    string
+		args    args
+		want    *image.NRGBA
+		wantErr bool
 	}{
 		{
 			name: "hide data",
 			args: args{
-				data: []byte{0b1101_0001, 0b0001_1001},
-				image: newTestImage([...]color.NRGBA{
+				data: stego.Envelope{Data: []byte{0b1101_0001, 0b0001_1001}},
+				image: newTestImage([]color.NRGBA{
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				}),
+				options: hideOptions{depth: 1, channels: stego.RGB},
+			},
+			want: newTestImage([]color.NRGBA{
+				{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC1, 0xD0},
+				{0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+				{0xA0, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0},
+				{0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0},
+				{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+			}),
+		},
+		{
+			name: "skip transparent pixels",
+			args: args{
+				data: stego.Envelope{Data: []byte{0b1101_0001, 0b0001_1001}},
+				image: newTestImage([]color.NRGBA{
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0x00}, {0xA0, 0xB0, 0xC0, 0x00}, {0xA0, 0xB0, 0xC0, 0x00}, {0xA0, 0xB0, 0xC0, 0x00},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
 					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
 					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
 					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
 					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
 				}),
+				options: hideOptions{depth: 1, channels: stego.RGB},
 			},
-			want: newTestImage([...]color.NRGBA{
-				{0xA0, 0xB0, 0xC0, 0xD1}, {0xA0, 0xB0, 0xC1, 0xD1}, {0xA0, 0xB0, 0xC1, 0xD1}, {0xA0, 0xB1, 0xC1, 0xD1},
-				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
-				{0xA1, 0xB1, 0xC0, 0xD1}, {0xA0, 0xB0, 0xC0, 0xD1}, {0xA0, 0xB0, 0xC0, 0xD1}, {0xA1, 0xB0, 0xC0, 0xD1},
+			want: newTestImage([]color.NRGBA{
+				{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC1, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0x00}, {0xA0, 0xB0, 0xC0, 0x00}, {0xA0, 0xB0, 0xC0, 0x00}, {0xA0, 0xB0, 0xC0, 0x00},
+				{0xA0, 0xB1, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+				{0xA0, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0},
+				{0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0},
+				{0xA1, 0xB0, 0xC1, 0xD0}, {0xA1, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB0, 0xC1, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
 				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC1, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC1, 0xD0},
+				{0xA0, 0xB0, 0xC0, 0xD0}, {0xA1, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB1, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
 			}),
 		},
+		{
+			name: "data too large",
+			args: args{
+				data: stego.Envelope{Data: []byte{0b1101_0001, 0b0001_1001, 0b1111_1111}},
+				image: newTestImage([]color.NRGBA{
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+					{0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0}, {0xA0, 0xB0, 0xC0, 0xD0},
+				}),
+				options: hideOptions{depth: 1, channels: stego.RGB},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			hideData(tt.args.data, tt.args.image)
+			err := hideData(tt.args.data, []image.Image{tt.args.image}, tt.args.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HideData(): want error %v got error %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
 			if !reflect.DeepEqual(tt.args.image, tt.want) {
 				t.Errorf("HideData(): data was not successfully hidden")
 			}
@@ -46,12 +134,148 @@ func Test_hideData(t *testing.T) {
 	}
 }
 
-func newTestImage(colors [16]color.NRGBA) *image.NRGBA {
-	shape := 4
-	img := image.NewNRGBA(image.Rect(0, 0, shape, shape))
-	for y := 0; y < shape; y++ {
-		for x := 0; x < shape; x++ {
-			img.Set(x, y, colors[x+y*shape])
+func Test_hideDataShards(t *testing.T) {
+	envelope := stego.Envelope{Data: []byte("Here's the hidden data, split across two images")}
+	images := []*image.NRGBA{
+		image.NewNRGBA(image.Rect(0, 0, 16, 16)),
+		image.NewNRGBA(image.Rect(0, 0, 16, 8)),
+	}
+	for _, img := range images {
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{0xA0, 0xB0, 0xC0, 0xFF}), image.Point{}, draw.Src)
+	}
+
+	err := hideData(envelope, []image.Image{images[0], images[1]}, hideOptions{depth: 1, channels: stego.RGB, compress: compressNever})
+	if err != nil {
+		t.Fatalf("hideData(): unexpected error %v", err)
+	}
+
+	var got []byte
+	var set uint64
+	for i, img := range images {
+		r := stego.NewReader(img.Pix, stego.Layout{Channels: stego.RGB})
+		header, err := stego.ReadHeader(r)
+		if err != nil {
+			t.Fatalf("ReadHeader(): unexpected error %v", err)
+		}
+		if header.Shard.Index != uint64(i) || header.Shard.Total != 2 {
+			t.Errorf("hideData(): image %d has shard %d of %d", i, header.Shard.Index, header.Shard.Total)
+		}
+		if i == 0 {
+			set = header.Shard.Set
+		}
+		if header.Shard.Set != set {
+			t.Errorf("hideData(): image %d is in set %x, want %x", i, header.Shard.Set, set)
+		}
+
+		data := make([]byte, header.Length)
+		_, err = r.Read(data)
+		if err != nil {
+			t.Fatalf("Read(): unexpected error %v", err)
+		}
+		if header.Verify(data) != nil {
+			t.Errorf("hideData(): image %d failed its checksum", i)
+		}
+		got = append(got, data...)
+	}
+
+	want, _ := envelope.MarshalBinary()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hideData(): shards = %q, want %q", got, want)
+	}
+}
+
+func Test_encodePNGChunk(t *testing.T) {
+	envelope := stego.Envelope{Data: []byte("Here's the hidden data")}
+	chunk, err := hideChunk(envelope, hideOptions{compress: compressNever, parity: 8})
+	if err != nil {
+		t.Fatalf("hideChunk(): unexpected error %v", err)
+	}
+
+	img := newTestImage([]color.NRGBA{
+		{0xA0, 0xB0, 0xC0, 0xFF}, {0xA1, 0xB1, 0xC1, 0xFF}, {0xA2, 0xB2, 0xC2, 0xFF}, {0xA3, 0xB3, 0xC3, 0xFF},
+	})
+	var buf bytes.Buffer
+	err = encodePNG(&buf, img, []pngchunk.Chunk{chunk})
+	if err != nil {
+		t.Fatalf("encodePNG(): unexpected error %v", err)
+	}
+
+	// the pixels are untouched and the chunk is read back as it was written
+	decoded, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("png.Decode(): unexpected error %v", err)
+	}
+	if carrier, _ := stego.Carrier(decoded); !reflect.DeepEqual(carrier, img) {
+		t.Errorf("encodePNG(): pixels changed")
+	}
+	chunks, err := pngchunk.Read(&buf)
+	if err != nil {
+		t.Fatalf("pngchunk.Read(): unexpected error %v", err)
+	}
+	got, ok := pngchunk.Find(chunks, stego.ChunkType)
+	if !ok || !bytes.Equal(got.Data, chunk.Data) {
+		t.Fatalf("encodePNG(): missing %s chunk", stego.ChunkType)
+	}
+
+	r := bytes.NewReader(got.Data)
+	header, err := stego.ReadHeader(r)
+	if err != nil {
+		t.Fatalf("ReadHeader(): unexpected error %v", err)
+	}
+	if header.Parity != 8 || header.Length != uint64(r.Len()) {
+		t.Errorf("hideChunk(): header = %+v with %d bytes of data", header, r.Len())
+	}
+}
+
+func Test_readMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := pngchunk.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []pngchunk.Chunk{
+		{Type: "gAMA", Data: []byte{0x00, 0x00, 0xB1, 0x8F}},
+		{Type: "bKGD", Data: []byte{0x00, 0xFF}},
+		{Type: "tEXt", Data: []byte("Title\x00Beach")},
+		{Type: stego.ChunkType, Data: []byte("old hidden data")},
+	} {
+		chunks = pngchunk.Insert(chunks, chunk)
+	}
+
+	path := filepath.Join(t.TempDir(), "src.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pngchunk.Write(f, chunks)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// chunks that depend on the color type, and old hidden data, are not copied
+	got, err := readMetadata(path)
+	if err != nil {
+		t.Fatalf("readMetadata(): unexpected error %v", err)
+	}
+	want := []pngchunk.Chunk{chunks[1], chunks[4]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readMetadata() = %v, want %v", got, want)
+	}
+}
+
+// newTestImage creates an image that is 4 pixels wide and as tall as needed to fit colors
+func newTestImage(colors []color.NRGBA) *image.NRGBA {
+	width := 4
+	height := len(colors) / width
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, colors[x+y*width])
 		}
 	}
 
@@ -0,0 +1,139 @@
+package hideimage
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bjatkin/imgdemo/cli"
+	"github.com/bjatkin/imgdemo/stego"
+)
+
+// hideImageArgs are the arguments for the hide-image command
+type hideImageArgs struct {
+	coverPath  string
+	secretPath string
+	outputPath string
+	bits       int
+}
+
+// Cmd is the hide-image command that hides one image inside the low bits of another
+var Cmd = &cli.Cmd[hideImageArgs]{
+	Name:        "hide-image",
+	Usage:       "hide-image [-bits 1-7] [COVER IMAGE PATH] [SECRET IMAGE PATH] [OUTPUT IMAGE PATH]",
+	Description: "hide an image inside the lowest bits of a cover image, use reveal to see it again",
+	Examples: []cli.Example{
+		{
+			Description: "hide the top 4 bits of 'secret.png' in the lowest 4 bits of 'cover.png'",
+			Args:        []string{"cover.png", "secret.png", "img.png"},
+		},
+		{
+			Description: "use only 2 bits so 'img.png' looks more like the cover, at the cost of a rougher secret",
+			Args:        []string{"-bits", "2", "cover.png", "secret.png", "img.png"},
+		},
+	},
+	ParseArgs: func(args []string) (hideImageArgs, error) {
+		var bits int
+		flags := flag.NewFlagSet("hide-image", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.IntVar(&bits, "bits", 4, "number of low bits of the cover used for the secret image")
+		err := flags.Parse(args)
+		if err != nil {
+			return hideImageArgs{}, err
+		}
+		args = flags.Args()
+
+		if len(args) != 3 {
+			return hideImageArgs{}, errors.New("expected exactly 3 arguments")
+		}
+
+		if bits < 1 || bits > stego.MaxImageBits {
+			return hideImageArgs{}, fmt.Errorf("bits must be between 1 and %d", stego.MaxImageBits)
+		}
+
+		if !strings.HasSuffix(args[2], ".png") {
+			return hideImageArgs{}, errors.New("png is the only supported output image format")
+		}
+
+		return hideImageArgs{
+			coverPath:  args[0],
+			secretPath: args[1],
+			outputPath: args[2],
+			bits:       bits,
+		}, nil
+	},
+	Fn: func(args hideImageArgs) error {
+		cover, err := readImage(args.coverPath)
+		if err != nil {
+			return err
+		}
+
+		secret, err := readImage(args.secretPath)
+		if err != nil {
+			return err
+		}
+
+		// the secret is stretched to cover every pixel of the cover
+		secret = scaleImage(cover.Bounds(), secret)
+		err = stego.HideImage(cover, secret, args.bits)
+		if err != nil {
+			return fmt.Errorf("failed to hide image: %w", err)
+		}
+
+		fout, err := os.Create(args.outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to open destination file: %w", err)
+		}
+		defer fout.Close()
+
+		err = png.Encode(fout, cover)
+		if err != nil {
+			return fmt.Errorf("failed to encode png output image: %w", err)
+		}
+
+		return fout.Close()
+	},
+}
+
+// readImage decodes the image at path and copies it into an NRGBA image
+func readImage(path string) (*image.NRGBA, error) {
+	imageFile, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+	defer imageFile.Close()
+
+	img, _, err := image.Decode(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image file '%s': %w", path, err)
+	}
+
+	rgbaImg := image.NewNRGBA(img.Bounds())
+	draw.Draw(rgbaImg, img.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgbaImg, nil
+}
+
+// scaleImage scales src to the size of destRect using the nearest pixel
+func scaleImage(destRect image.Rectangle, src *image.NRGBA) *image.NRGBA {
+	factorX := float64(src.Bounds().Dx()) / float64(destRect.Dx())
+	factorY := float64(src.Bounds().Dy()) / float64(destRect.Dy())
+
+	img := image.NewNRGBA(destRect)
+	for y := destRect.Min.Y; y < destRect.Max.Y; y++ {
+		for x := destRect.Min.X; x < destRect.Max.X; x++ {
+			srcX := src.Bounds().Min.X + int(float64(x-destRect.Min.X)*factorX)
+			srcY := src.Bounds().Min.Y + int(float64(y-destRect.Min.Y)*factorY)
+			img.SetNRGBA(x, y, src.NRGBAAt(srcX, srcY))
+		}
+	}
+
+	return img
+}
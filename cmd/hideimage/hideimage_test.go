@@ -0,0 +1,24 @@
+package hideimage
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func Test_scaleImage(t *testing.T) {
+	// the source does not start at the origin, like a cropped sub image
+	src := image.NewNRGBA(image.Rect(1, 1, 3, 2))
+	src.SetNRGBA(1, 1, color.NRGBA{0xFF, 0x00, 0x00, 0xFF})
+	src.SetNRGBA(2, 1, color.NRGBA{0x00, 0x00, 0xFF, 0xFF})
+
+	got := scaleImage(image.Rect(0, 0, 4, 2), src)
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			want := src.NRGBAAt(1+x/2, 1)
+			if c := got.NRGBAAt(x, y); c != want {
+				t.Errorf("scaleImage() pixel %d,%d = %v, want %v", x, y, c, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package keygen
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bjatkin/imgdemo/cli"
+	"github.com/bjatkin/imgdemo/stego"
+)
+
+// keygenArgs are the arguments for the keygen command
+type keygenArgs struct {
+	keyPath string
+}
+
+// Cmd is the keygen command that creates an X25519 key pair for hiding data for recipients
+var Cmd = &cli.Cmd[keygenArgs]{
+	Name:        "keygen",
+	Usage:       "keygen [KEY PATH]",
+	Description: "create a key pair, hide encrypts data for the public key and find decrypts it with the private key",
+	Examples: []cli.Example{
+		{
+			Description: "write a private key to 'id.pem' and its public key to 'id.pem.pub'",
+			Args:        []string{"id.pem"},
+		},
+		{
+			Description: "existing keys are never overwritten",
+			Args:        []string{"id.pem"},
+			Error:       errors.New("failed to create private key file: open id.pem: file exists"),
+		},
+	},
+	ParseArgs: func(args []string) (keygenArgs, error) {
+		flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		err := flags.Parse(args)
+		if err != nil {
+			return keygenArgs{}, err
+		}
+		args = flags.Args()
+
+		if len(args) != 1 {
+			return keygenArgs{}, errors.New("expected exactly 1 argument")
+		}
+
+		return keygenArgs{keyPath: args[0]}, nil
+	},
+	Fn: func(args keygenArgs) error {
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+
+		return writeKeys(args.keyPath, key)
+	},
+}
+
+// writeKeys writes the PEM encoded private key to path, and its public key to path with
+// a '.pub' extension. The private key can only be read by its owner
+func writeKeys(path string, key *ecdh.PrivateKey) error {
+	privateData, err := stego.MarshalPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	publicData, err := stego.MarshalPublicKey(key.PublicKey())
+	if err != nil {
+		return fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	err = writeNewFile(path, privateData, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create private key file: %w", err)
+	}
+
+	err = writeNewFile(path+".pub", publicData, 0o644)
+	if err != nil {
+		// a private key without its public key is not useful, so don't leave it behind
+		os.Remove(path)
+		return fmt.Errorf("failed to create public key file: %w", err)
+	}
+
+	return nil
+}
+
+// writeNewFile writes data to a new file at path, it fails if the file already exists
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	fout, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer fout.Close()
+
+	_, err = fout.Write(data)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	err = fout.Close()
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
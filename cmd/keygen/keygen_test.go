@@ -0,0 +1,92 @@
+package keygen
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bjatkin/imgdemo/stego"
+)
+
+func Test_writeKeys(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() unexpected error %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "id.pem")
+	err = writeKeys(path, key)
+	if err != nil {
+		t.Fatalf("writeKeys() unexpected error %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat private key: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("writeKeys() private key mode = %v, want %v", info.Mode().Perm(), os.FileMode(0o600))
+	}
+
+	privateData, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read private key: %v", err)
+	}
+	privateKey, err := stego.ParsePrivateKey(privateData)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() unexpected error %v", err)
+	}
+	if !privateKey.Equal(key) {
+		t.Errorf("writeKeys() wrote a different private key")
+	}
+
+	publicData, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+	publicKey, err := stego.ParsePublicKey(publicData)
+	if err != nil {
+		t.Fatalf("ParsePublicKey() unexpected error %v", err)
+	}
+	if !publicKey.Equal(key.PublicKey()) {
+		t.Errorf("writeKeys() wrote a different public key")
+	}
+
+	err = writeKeys(path, key)
+	if err == nil {
+		t.Errorf("writeKeys() expected an error when the key already exists")
+	}
+}
+
+func Test_writeKeysPublicKeyExists(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() unexpected error %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "id.pem")
+	err = os.WriteFile(path+".pub", []byte("existing key"), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write public key: %v", err)
+	}
+
+	err = writeKeys(path, key)
+	if err == nil {
+		t.Fatalf("writeKeys() expected an error when the public key already exists")
+	}
+
+	_, err = os.Stat(path)
+	if !os.IsNotExist(err) {
+		t.Errorf("writeKeys() left the private key behind, stat error = %v", err)
+	}
+
+	publicData, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+	if string(publicData) != "existing key" {
+		t.Errorf("writeKeys() changed the existing public key to %q", publicData)
+	}
+}
@@ -0,0 +1,101 @@
+package reveal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bjatkin/imgdemo/cli"
+	"github.com/bjatkin/imgdemo/stego"
+)
+
+// revealArgs are the arguments for the reveal command
+type revealArgs struct {
+	imagePath  string
+	outputPath string
+	bits       int
+}
+
+// Cmd is the reveal command that rebuilds an image hidden with the hide-image command
+var Cmd = &cli.Cmd[revealArgs]{
+	Name:        "reveal",
+	Usage:       "reveal [-bits 1-7] [IMAGE PATH] [OUTPUT IMAGE PATH]",
+	Description: "rebuild an image hidden inside another image with the hide-image command",
+	Examples: []cli.Example{
+		{
+			Description: "rebuild the image hidden in the lowest 4 bits of 'img.png'",
+			Args:        []string{"img.png", "secret.png"},
+		},
+		{
+			Description: "rebuild an image that was hidden using 2 bits",
+			Args:        []string{"-bits", "2", "img.png", "secret.png"},
+		},
+	},
+	ParseArgs: func(args []string) (revealArgs, error) {
+		var bits int
+		flags := flag.NewFlagSet("reveal", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.IntVar(&bits, "bits", 4, "number of low bits the secret image was hidden in")
+		err := flags.Parse(args)
+		if err != nil {
+			return revealArgs{}, err
+		}
+		args = flags.Args()
+
+		if len(args) != 2 {
+			return revealArgs{}, errors.New("expected exactly 2 arguments")
+		}
+
+		if bits < 1 || bits > stego.MaxImageBits {
+			return revealArgs{}, fmt.Errorf("bits must be between 1 and %d", stego.MaxImageBits)
+		}
+
+		if !strings.HasSuffix(args[1], ".png") {
+			return revealArgs{}, errors.New("png is the only supported output image format")
+		}
+
+		return revealArgs{
+			imagePath:  args[0],
+			outputPath: args[1],
+			bits:       bits,
+		}, nil
+	},
+	Fn: func(args revealArgs) error {
+		imageFile, err := os.Open(args.imagePath)
+		if err != nil {
+			return fmt.Errorf("failed to read image file: %w", err)
+		}
+		defer imageFile.Close()
+
+		img, _, err := image.Decode(imageFile)
+		if err != nil {
+			return fmt.Errorf("failed to decode image file: %w", err)
+		}
+
+		rgbaImg := image.NewNRGBA(img.Bounds())
+		draw.Draw(rgbaImg, img.Bounds(), img, img.Bounds().Min, draw.Src)
+		secret, err := stego.RevealImage(rgbaImg, args.bits)
+		if err != nil {
+			return fmt.Errorf("failed to reveal image: %w", err)
+		}
+
+		fout, err := os.Create(args.outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to open destination file: %w", err)
+		}
+		defer fout.Close()
+
+		err = png.Encode(fout, secret)
+		if err != nil {
+			return fmt.Errorf("failed to encode png output image: %w", err)
+		}
+
+		return fout.Close()
+	},
+}
@@ -0,0 +1,121 @@
+package reveal
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/bjatkin/imgdemo/cmd/hideimage"
+)
+
+func Test_reveal(t *testing.T) {
+	tests := []struct {
+		name   string
+		cover  image.Point
+		secret image.Point
+		bits   int
+	}{
+		{name: "same size", cover: image.Pt(6, 4), secret: image.Pt(6, 4), bits: 4},
+		{name: "secret stretched over the cover", cover: image.Pt(8, 6), secret: image.Pt(4, 3), bits: 2},
+		{name: "cover too small for the secret", cover: image.Pt(4, 3), secret: image.Pt(8, 6), bits: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			coverPath := filepath.Join(dir, "cover.png")
+			secretPath := filepath.Join(dir, "secret.png")
+			hiddenPath := filepath.Join(dir, "img.png")
+			revealedPath := filepath.Join(dir, "revealed.png")
+
+			secret := newTestImage(tt.secret, 37, 11)
+			writePNG(t, coverPath, newTestImage(tt.cover, 5, 90))
+			writePNG(t, secretPath, secret)
+
+			bits := strconv.Itoa(tt.bits)
+			hideArgs, err := hideimage.Cmd.ParseArgs([]string{"-bits", bits, coverPath, secretPath, hiddenPath})
+			if err != nil {
+				t.Fatalf("hide-image ParseArgs() unexpected error %v", err)
+			}
+			err = hideimage.Cmd.Fn(hideArgs)
+			if err != nil {
+				t.Fatalf("hide-image Fn() unexpected error %v", err)
+			}
+
+			args, err := Cmd.ParseArgs([]string{"-bits", bits, hiddenPath, revealedPath})
+			if err != nil {
+				t.Fatalf("ParseArgs() unexpected error %v", err)
+			}
+			err = Cmd.Fn(args)
+			if err != nil {
+				t.Fatalf("Fn() unexpected error %v", err)
+			}
+
+			revealed := readPNG(t, revealedPath)
+			if got := revealed.Bounds().Size(); got != tt.cover {
+				t.Fatalf("reveal size = %v, want %v", got, tt.cover)
+			}
+
+			// the secret is scaled to the cover using the nearest pixel, and only its
+			// top bits are kept with the rest set to the middle of their range
+			keep := uint8(0xFF) << (8 - tt.bits)
+			half := uint8(0x80) >> tt.bits
+			for y := 0; y < tt.cover.Y; y++ {
+				for x := 0; x < tt.cover.X; x++ {
+					c := secret.NRGBAAt(x*tt.secret.X/tt.cover.X, y*tt.secret.Y/tt.cover.Y)
+					want := color.NRGBA{c.R&keep | half, c.G&keep | half, c.B&keep | half, 0xFF}
+					if got := color.NRGBAModel.Convert(revealed.At(x, y)); got != want {
+						t.Errorf("reveal pixel %d,%d = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// newTestImage creates an opaque image where every pixel has a different color
+func newTestImage(size image.Point, stepX, stepY int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rectangle{Max: size})
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * stepX), uint8(y * stepY), uint8(x*stepY + y*stepX), 0xFF})
+		}
+	}
+
+	return img
+}
+
+// writePNG encodes img as a png file at path
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	fout, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fout.Close()
+
+	err = png.Encode(fout, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readPNG decodes the png file at path
+func readPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	fin, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fin.Close()
+
+	img, err := png.Decode(fin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
@@ -0,0 +1,362 @@
+package dct
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnsupported is returned for jpeg images that are not baseline, or that need more
+// than one scan
+var ErrUnsupported = errors.New("only baseline jpeg images with a single scan are supported")
+
+// jpeg markers
+const (
+	markerSOF0 = 0xC0
+	markerSOF1 = 0xC1
+	markerDHT  = 0xC4
+	markerRST0 = 0xD0
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerDRI  = 0xDD
+)
+
+// Image holds the quantized DCT coefficients of a baseline jpeg image. Everything
+// other than the coefficients, like the quantization and huffman tables and any
+// metadata, is kept exactly as it was read
+type Image struct {
+	Width, Height int
+	Components    []Component
+
+	// header is every byte of the image up to and including the start of scan
+	// segment, and trailer is every byte after the compressed coefficients
+	header, trailer []byte
+	// scan is the index of each component in the order they appear in the scan
+	scan            []int
+	restartInterval int
+	mcusX, mcusY    int
+	dc, ac          [4]*huffman
+}
+
+// Component is one color component of a jpeg image
+type Component struct {
+	ID uint8
+	// H and V are the horizontal and vertical sampling factors
+	H, V int
+	// BlocksX and BlocksY are the number of blocks in each row and column
+	BlocksX, BlocksY int
+	// Blocks holds the 64 coefficients of every block in zigzag order, with the DC
+	// coefficient first. Blocks are in rows of BlocksX
+	Blocks [][64]int32
+
+	dcTable uint8
+	acTable uint8
+}
+
+// Decode reads the coefficients of a baseline jpeg image from r
+func Decode(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, errors.New("missing jpeg start of image marker")
+	}
+
+	img := &Image{}
+	pos := 2
+	for {
+		// markers can be padded with any number of 0xFF bytes
+		for pos+1 < len(data) && data[pos] == 0xFF && data[pos+1] == 0xFF {
+			pos++
+		}
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, fmt.Errorf("invalid jpeg marker at offset %d", pos)
+		}
+
+		marker := data[pos+1]
+		if marker == markerEOI {
+			return nil, errors.New("jpeg image has no scan")
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, fmt.Errorf("invalid jpeg segment length %d", length)
+		}
+		segment := data[pos+4 : end]
+
+		switch {
+		case marker == markerSOF0 || marker == markerSOF1:
+			err = img.parseFrame(segment)
+		case marker == markerDHT:
+			err = img.parseHuffman(segment)
+		case marker == markerDRI:
+			if len(segment) != 2 {
+				return nil, errors.New("invalid jpeg restart interval")
+			}
+			img.restartInterval = int(binary.BigEndian.Uint16(segment))
+		case marker >= 0xC2 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			// every other start of frame marker is progressive, lossless or arithmetic coded
+			return nil, ErrUnsupported
+		case marker == markerSOS:
+			err = img.parseScan(segment)
+			if err != nil {
+				return nil, err
+			}
+			img.header = data[:end]
+			return img, img.decodeScan(data[end:])
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		pos = end
+	}
+}
+
+// parseFrame reads a start of frame segment
+func (img *Image) parseFrame(segment []byte) error {
+	if img.Components != nil {
+		return errors.New("jpeg image has more than one frame")
+	}
+	if len(segment) < 6 || segment[0] != 8 {
+		return ErrUnsupported
+	}
+
+	img.Height = int(binary.BigEndian.Uint16(segment[1:]))
+	img.Width = int(binary.BigEndian.Uint16(segment[3:]))
+	count := int(segment[5])
+	if img.Width == 0 || img.Height == 0 || count == 0 || count > 4 || len(segment) != 6+3*count {
+		return errors.New("invalid jpeg frame")
+	}
+
+	hMax, vMax := 1, 1
+	for i := 0; i < count; i++ {
+		c := segment[6+3*i:]
+		component := Component{ID: c[0], H: int(c[1] >> 4), V: int(c[1] & 0x0F)}
+		if component.H < 1 || component.H > 4 || component.V < 1 || component.V > 4 {
+			return errors.New("invalid jpeg sampling factor")
+		}
+		hMax, vMax = max(hMax, component.H), max(vMax, component.V)
+		img.Components = append(img.Components, component)
+	}
+
+	// blocks are grouped into MCUs when there is more than one component, which pads
+	// each component out to a whole number of MCUs
+	img.mcusX = ceilDiv(img.Width, 8*hMax)
+	img.mcusY = ceilDiv(img.Height, 8*vMax)
+	for i := range img.Components {
+		c := &img.Components[i]
+		if count == 1 {
+			c.BlocksX = ceilDiv(ceilDiv(img.Width*c.H, hMax), 8)
+			c.BlocksY = ceilDiv(ceilDiv(img.Height*c.V, vMax), 8)
+		} else {
+			c.BlocksX = img.mcusX * c.H
+			c.BlocksY = img.mcusY * c.V
+		}
+		c.Blocks = make([][64]int32, c.BlocksX*c.BlocksY)
+	}
+
+	return nil
+}
+
+// parseHuffman reads a define huffman table segment, which can hold several tables
+func (img *Image) parseHuffman(segment []byte) error {
+	for len(segment) > 0 {
+		if len(segment) < 17 {
+			return errors.New("invalid jpeg huffman table")
+		}
+
+		class, id := segment[0]>>4, segment[0]&0x0F
+		if class > 1 || id > 3 {
+			return errors.New("invalid jpeg huffman table")
+		}
+
+		var counts [16]uint8
+		copy(counts[:], segment[1:17])
+		total := 0
+		for _, count := range counts {
+			total += int(count)
+		}
+		if len(segment) < 17+total {
+			return errors.New("invalid jpeg huffman table")
+		}
+
+		table, err := newHuffman(counts, segment[17:17+total])
+		if err != nil {
+			return err
+		}
+		if class == 0 {
+			img.dc[id] = table
+		} else {
+			img.ac[id] = table
+		}
+
+		segment = segment[17+total:]
+	}
+
+	return nil
+}
+
+// parseScan reads a start of scan segment
+func (img *Image) parseScan(segment []byte) error {
+	if img.Components == nil {
+		return errors.New("jpeg scan comes before the frame")
+	}
+	if len(segment) < 1 {
+		return errors.New("invalid jpeg scan")
+	}
+
+	count := int(segment[0])
+	if len(segment) != 4+2*count {
+		return errors.New("invalid jpeg scan")
+	}
+	// a single scan has to hold every component with every coefficient
+	spectral := segment[1+2*count:]
+	if count != len(img.Components) || spectral[0] != 0 || spectral[1] != 63 || spectral[2] != 0 {
+		return ErrUnsupported
+	}
+
+	for i := 0; i < count; i++ {
+		s := segment[1+2*i:]
+		index := -1
+		for j, c := range img.Components {
+			if c.ID == s[0] {
+				index = j
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("jpeg scan has unknown component %d", s[0])
+		}
+
+		c := &img.Components[index]
+		c.dcTable, c.acTable = s[1]>>4, s[1]&0x0F
+		if c.dcTable > 3 || c.acTable > 3 || img.dc[c.dcTable] == nil || img.ac[c.acTable] == nil {
+			return errors.New("jpeg scan uses a missing huffman table")
+		}
+		img.scan = append(img.scan, index)
+	}
+
+	return nil
+}
+
+// blockRef picks one block of one component
+type blockRef struct {
+	component, block int
+}
+
+// mcus returns the blocks in every MCU, in the order they are stored in the scan
+func (img *Image) mcus() [][]blockRef {
+	var mcus [][]blockRef
+	if len(img.scan) == 1 {
+		c := img.Components[img.scan[0]]
+		for i := range c.Blocks {
+			mcus = append(mcus, []blockRef{{img.scan[0], i}})
+		}
+		return mcus
+	}
+
+	for y := 0; y < img.mcusY; y++ {
+		for x := 0; x < img.mcusX; x++ {
+			var mcu []blockRef
+			for _, index := range img.scan {
+				c := img.Components[index]
+				for v := 0; v < c.V; v++ {
+					for h := 0; h < c.H; h++ {
+						mcu = append(mcu, blockRef{index, (y*c.V+v)*c.BlocksX + x*c.H + h})
+					}
+				}
+			}
+			mcus = append(mcus, mcu)
+		}
+	}
+
+	return mcus
+}
+
+// decodeScan reads the huffman coded coefficients that follow the start of scan
+// segment, everything after them is kept as the trailer
+func (img *Image) decodeScan(data []byte) error {
+	r := &bitReader{data: data}
+	var predictions [4]int32
+	for i, mcu := range img.mcus() {
+		if img.restartInterval != 0 && i != 0 && i%img.restartInterval == 0 {
+			err := r.restart((i/img.restartInterval - 1) % 8)
+			if err != nil {
+				return err
+			}
+			predictions = [4]int32{}
+		}
+
+		for _, ref := range mcu {
+			c := &img.Components[ref.component]
+			err := r.readBlock(&c.Blocks[ref.block], &predictions[ref.component], img.dc[c.dcTable], img.ac[c.acTable])
+			if err != nil {
+				return fmt.Errorf("failed to read jpeg coefficients: %w", err)
+			}
+		}
+	}
+
+	// the rest of the scan's last byte is padding
+	end := r.pos
+	for end+1 < len(data) && data[end] == 0xFF && data[end+1] == 0xFF {
+		end++
+	}
+	if end+1 >= len(data) || data[end] != 0xFF {
+		return errors.New("jpeg scan is not followed by a marker")
+	}
+	img.trailer = data[end:]
+
+	// any more scans would hold coefficients that are not read
+	for pos := 0; pos+1 < len(img.trailer); pos++ {
+		if img.trailer[pos] == 0xFF && img.trailer[pos+1] == markerSOS {
+			return ErrUnsupported
+		}
+		if img.trailer[pos] == 0xFF && img.trailer[pos+1] == markerEOI {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Encode writes the image as a jpeg, the coefficients are compressed again using the
+// image's own huffman tables. Every huffman code needed must already be in the tables,
+// which is always the case as long as no coefficient changes its magnitude category
+// or becomes 0
+func (img *Image) Encode(w io.Writer) error {
+	bw := &bitWriter{}
+	var predictions [4]int32
+	for i, mcu := range img.mcus() {
+		if img.restartInterval != 0 && i != 0 && i%img.restartInterval == 0 {
+			bw.restart((i/img.restartInterval - 1) % 8)
+			predictions = [4]int32{}
+		}
+
+		for _, ref := range mcu {
+			c := &img.Components[ref.component]
+			err := bw.writeBlock(&c.Blocks[ref.block], &predictions[ref.component], img.dc[c.dcTable], img.ac[c.acTable])
+			if err != nil {
+				return fmt.Errorf("failed to write jpeg coefficients: %w", err)
+			}
+		}
+	}
+	bw.flush()
+
+	for _, part := range [][]byte{img.header, bw.data, img.trailer} {
+		_, err := w.Write(part)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ceilDiv divides a by b rounding up
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
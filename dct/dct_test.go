@@ -0,0 +1,109 @@
+package dct
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"reflect"
+	"testing"
+)
+
+// testJPEG encodes a noisy test image as a baseline jpeg
+func testJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 37, 21))
+	gray := image.NewGray(image.Rect(0, 0, 19, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 37; x++ {
+			rgba.Set(x, y, color.RGBA{uint8(x * y * 7), uint8(x * 13), uint8(y*29 + x), 0xFF})
+			gray.Set(x, y, color.Gray{uint8(x*x*5 + y*11)})
+		}
+	}
+
+	tests := []struct {
+		name       string
+		img        image.Image
+		components int
+	}{
+		{name: "color", img: rgba, components: 3},
+		{name: "gray", img: gray, components: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testJPEG(t, tt.img)
+			img, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Decode() unexpected error %v", err)
+			}
+			if len(img.Components) != tt.components {
+				t.Fatalf("Decode() got %d components, want %d", len(img.Components), tt.components)
+			}
+
+			var buf bytes.Buffer
+			err = img.Encode(&buf)
+			if err != nil {
+				t.Fatalf("Encode() unexpected error %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Errorf("Encode() did not write the same jpeg that was decoded")
+			}
+		})
+	}
+}
+
+func TestRestartInterval(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 40, 24))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 37)
+	}
+	img, err := Decode(bytes.NewReader(testJPEG(t, src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add a restart interval of 2 MCUs straight after the start of image marker
+	img.header = append([]byte{0xFF, markerSOI, 0xFF, markerDRI, 0x00, 0x04, 0x00, 0x02}, img.header[2:]...)
+	img.restartInterval = 2
+	var buf bytes.Buffer
+	err = img.Encode(&buf)
+	if err != nil {
+		t.Fatalf("Encode() unexpected error %v", err)
+	}
+
+	got, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode() unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(got.Components[0].Blocks, img.Components[0].Blocks) {
+		t.Errorf("Decode() coefficients changed after adding restart markers")
+	}
+	_, err = jpeg.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Errorf("jpeg.Decode() unexpected error %v", err)
+	}
+}
+
+func TestDecodeProgressive(t *testing.T) {
+	data := testJPEG(t, image.NewGray(image.Rect(0, 0, 8, 8)))
+
+	// switch the baseline start of frame marker for a progressive one
+	i := bytes.Index(data, []byte{0xFF, markerSOF0})
+	data[i+1] = 0xC2
+	_, err := Decode(bytes.NewReader(data))
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Decode() error = %v, want %v", err, ErrUnsupported)
+	}
+}
@@ -0,0 +1,287 @@
+package dct
+
+import (
+	"errors"
+	"fmt"
+)
+
+// huffman is a jpeg huffman table, it can both decode and encode symbols
+type huffman struct {
+	// maxCode, minCode and valPtr are indexed by code length, see section F.2.2.3 of
+	// the jpeg spec. maxCode is -1 for lengths that have no codes
+	maxCode [17]int32
+	minCode [17]int32
+	valPtr  [17]int
+	values  []uint8
+
+	// codes and sizes hold the code for each symbol, sizes is 0 for symbols that are
+	// not in the table
+	codes [256]uint16
+	sizes [256]uint8
+}
+
+// newHuffman builds a huffman table from the number of codes of each length and the
+// symbols in code order
+func newHuffman(counts [16]uint8, values []uint8) (*huffman, error) {
+	h := &huffman{values: values}
+	code, k := int32(0), 0
+	for l := 1; l <= 16; l++ {
+		count := int(counts[l-1])
+		h.valPtr[l] = k
+		h.minCode[l] = code
+		h.maxCode[l] = -1
+		if count > 0 {
+			h.maxCode[l] = code + int32(count) - 1
+		}
+
+		for _, symbol := range values[k : k+count] {
+			h.codes[symbol] = uint16(code)
+			h.sizes[symbol] = uint8(l)
+			code++
+		}
+		if code > 1<<l {
+			return nil, errors.New("invalid jpeg huffman table")
+		}
+
+		k += count
+		code <<= 1
+	}
+
+	return h, nil
+}
+
+// bitReader reads the bits of jpeg entropy coded data, skipping the 0x00 byte stuffed
+// after every 0xFF byte
+type bitReader struct {
+	data []byte
+	pos  int
+	bits byte
+	n    int
+}
+
+// readBit reads the next bit
+func (r *bitReader) readBit() (int32, error) {
+	if r.n == 0 {
+		if r.pos >= len(r.data) {
+			return 0, errors.New("unexpected end of data")
+		}
+
+		b := r.data[r.pos]
+		if b == 0xFF {
+			if r.pos+1 >= len(r.data) || r.data[r.pos+1] != 0x00 {
+				return 0, errors.New("unexpected marker")
+			}
+			r.pos++
+		}
+		r.pos++
+		r.bits, r.n = b, 8
+	}
+
+	r.n--
+	return int32(r.bits>>r.n) & 1, nil
+}
+
+// receive reads an s bit value and extends it to its signed value
+func (r *bitReader) receive(s int) (int32, error) {
+	v := int32(0)
+	for i := 0; i < s; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | bit
+	}
+
+	if s > 0 && v < 1<<(s-1) {
+		v += -1<<s + 1
+	}
+
+	return v, nil
+}
+
+// decode reads the next symbol coded with h
+func (r *bitReader) decode(h *huffman) (uint8, error) {
+	code := int32(0)
+	for l := 1; l <= 16; l++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+
+		code = code<<1 | bit
+		if code <= h.maxCode[l] {
+			return h.values[h.valPtr[l]+int(code-h.minCode[l])], nil
+		}
+	}
+
+	return 0, errors.New("invalid huffman code")
+}
+
+// readBlock reads the coefficients of one block, the DC coefficient is coded as the
+// difference from prediction, which is updated to the block's DC coefficient
+func (r *bitReader) readBlock(block *[64]int32, prediction *int32, dc, ac *huffman) error {
+	s, err := r.decode(dc)
+	if err != nil {
+		return err
+	}
+	if s > 11 {
+		return errors.New("invalid dc coefficient size")
+	}
+	diff, err := r.receive(int(s))
+	if err != nil {
+		return err
+	}
+	*prediction += diff
+	block[0] = *prediction
+
+	for k := 1; k < 64; k++ {
+		symbol, err := r.decode(ac)
+		if err != nil {
+			return err
+		}
+
+		run, size := int(symbol>>4), int(symbol&0x0F)
+		if size == 0 {
+			if run != 15 {
+				// end of block, the rest of the coefficients are 0
+				break
+			}
+			k += 15
+			continue
+		}
+
+		k += run
+		if k > 63 {
+			return errors.New("too many coefficients in block")
+		}
+		block[k], err = r.receive(size)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restart skips the padding bits before a restart marker and then the marker itself
+func (r *bitReader) restart(n int) error {
+	r.n = 0
+	if r.pos+1 >= len(r.data) || r.data[r.pos] != 0xFF || r.data[r.pos+1] != byte(markerRST0+n) {
+		return fmt.Errorf("missing jpeg restart marker %d", n)
+	}
+	r.pos += 2
+
+	return nil
+}
+
+// bitWriter writes jpeg entropy coded data, stuffing a 0x00 byte after every 0xFF byte
+type bitWriter struct {
+	data []byte
+	bits uint32
+	n    int
+}
+
+// write writes the low size bits of v
+func (w *bitWriter) write(v uint32, size int) {
+	for i := size - 1; i >= 0; i-- {
+		w.bits = w.bits<<1 | v>>i&1
+		w.n++
+		if w.n == 8 {
+			w.data = append(w.data, byte(w.bits))
+			if byte(w.bits) == 0xFF {
+				w.data = append(w.data, 0x00)
+			}
+			w.bits, w.n = 0, 0
+		}
+	}
+}
+
+// encode writes the code for symbol from h
+func (w *bitWriter) encode(h *huffman, symbol uint8) error {
+	if h.sizes[symbol] == 0 {
+		return fmt.Errorf("no huffman code for symbol %#x", symbol)
+	}
+
+	w.write(uint32(h.codes[symbol]), int(h.sizes[symbol]))
+	return nil
+}
+
+// writeValue writes the size category of v using h, followed by v's bits. run is the
+// number of zero coefficients before v, which is always 0 for DC coefficients
+func (w *bitWriter) writeValue(h *huffman, run int, v int32) error {
+	size := category(v)
+	err := w.encode(h, uint8(run<<4|size))
+	if err != nil {
+		return err
+	}
+
+	// negative values are stored as v-1 in size bits
+	if v < 0 {
+		v--
+	}
+	w.write(uint32(v), size)
+	return nil
+}
+
+// writeBlock writes the coefficients of one block, see readBlock
+func (w *bitWriter) writeBlock(block *[64]int32, prediction *int32, dc, ac *huffman) error {
+	err := w.writeValue(dc, 0, block[0]-*prediction)
+	if err != nil {
+		return err
+	}
+	*prediction = block[0]
+
+	run := 0
+	for k := 1; k < 64; k++ {
+		if block[k] == 0 {
+			run++
+			continue
+		}
+
+		for ; run >= 16; run -= 16 {
+			err = w.encode(ac, 0xF0)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = w.writeValue(ac, run, block[k])
+		if err != nil {
+			return err
+		}
+		run = 0
+	}
+
+	if run > 0 {
+		return w.encode(ac, 0x00)
+	}
+
+	return nil
+}
+
+// flush pads the last byte with 1 bits
+func (w *bitWriter) flush() {
+	if w.n > 0 {
+		w.write(0xFF, 8-w.n)
+	}
+}
+
+// restart pads the last byte and writes restart marker n
+func (w *bitWriter) restart(n int) {
+	w.flush()
+	w.data = append(w.data, 0xFF, byte(markerRST0+n))
+}
+
+// category returns the number of bits needed for the magnitude of v
+func category(v int32) int {
+	if v < 0 {
+		v = -v
+	}
+
+	size := 0
+	for ; v > 0; v >>= 1 {
+		size++
+	}
+
+	return size
+}
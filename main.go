@@ -4,9 +4,13 @@ import (
 	"os"
 
 	"github.com/bjatkin/imgdemo/cli"
+	"github.com/bjatkin/imgdemo/cmd/capacity"
 	"github.com/bjatkin/imgdemo/cmd/find"
 	"github.com/bjatkin/imgdemo/cmd/hide"
+	"github.com/bjatkin/imgdemo/cmd/hideimage"
 	"github.com/bjatkin/imgdemo/cmd/ishihara"
+	"github.com/bjatkin/imgdemo/cmd/keygen"
+	"github.com/bjatkin/imgdemo/cmd/reveal"
 )
 
 var Root = cli.Cmd[bool]{
@@ -14,9 +18,13 @@ var Root = cli.Cmd[bool]{
 	Description: "a simple tool demoing what can be accomplished using the go standard library",
 	Usage:       "imgdemo [COMMAND] [ARGS]",
 	SubCmds: []cli.Runable{
+		capacity.Cmd,
 		find.Cmd,
 		hide.Cmd,
+		hideimage.Cmd,
 		ishihara.Cmd,
+		keygen.Cmd,
+		reveal.Cmd,
 	},
 }
 
@@ -0,0 +1,126 @@
+package pngchunk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// signature is the 8 bytes every png file starts with
+const signature = "\x89PNG\r\n\x1a\n"
+
+// ErrNotPNG is returned when the data does not start with the png signature
+var ErrNotPNG = errors.New("not a png file")
+
+// Chunk is a single png chunk
+type Chunk struct {
+	// Type is the 4 letter chunk type, for example IHDR or tEXt
+	Type string
+	Data []byte
+}
+
+// Ancillary reports whether decoders can safely ignore the chunk, which is the case
+// when the first letter of its type is lower case
+func (c Chunk) Ancillary() bool {
+	return len(c.Type) == 4 && c.Type[0]&0x20 != 0
+}
+
+// Read reads every chunk of a png file, checking the CRC of each one. Any data after
+// the IEND chunk is ignored
+func Read(r io.Reader) ([]Chunk, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, ErrNotPNG
+	}
+
+	var chunks []Chunk
+	data = data[len(signature):]
+	for {
+		if len(data) < 12 {
+			return nil, errors.New("png file is missing its IEND chunk")
+		}
+
+		length := binary.BigEndian.Uint32(data)
+		if uint64(length) > uint64(len(data)-12) {
+			return nil, fmt.Errorf("invalid png chunk length %d", length)
+		}
+
+		body := data[4 : 8+length]
+		crc := binary.BigEndian.Uint32(data[8+length:])
+		if crc32.ChecksumIEEE(body) != crc {
+			return nil, fmt.Errorf("png %s chunk failed its CRC check", body[:4])
+		}
+
+		chunk := Chunk{Type: string(body[:4]), Data: body[4:]}
+		chunks = append(chunks, chunk)
+		if chunk.Type == "IEND" {
+			return chunks, nil
+		}
+
+		data = data[12+length:]
+	}
+}
+
+// Write writes chunks as a png file, the length and CRC of each chunk are worked out
+// from its type and data
+func Write(w io.Writer, chunks []Chunk) error {
+	buf := []byte(signature)
+	for _, chunk := range chunks {
+		if len(chunk.Type) != 4 {
+			return fmt.Errorf("invalid png chunk type '%s'", chunk.Type)
+		}
+
+		start := len(buf)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(chunk.Data)))
+		buf = append(buf, chunk.Type...)
+		buf = append(buf, chunk.Data...)
+		buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start+4:]))
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// Find returns the first chunk of the given type
+func Find(chunks []Chunk, chunkType string) (Chunk, bool) {
+	for _, chunk := range chunks {
+		if chunk.Type == chunkType {
+			return chunk, true
+		}
+	}
+
+	return Chunk{}, false
+}
+
+// beforeData are the ancillary chunks that have to come before the image data. cHRM,
+// gAMA, iCCP, sBIT and sRGB also have to come before the palette
+var beforeData = map[string]bool{
+	"cHRM": true,
+	"gAMA": true,
+	"iCCP": true,
+	"sBIT": true,
+	"sRGB": true,
+	"pHYs": true,
+	"sPLT": true,
+	"eXIf": true,
+}
+
+// Insert adds chunk to chunks where the png spec allows it. Chunks that have to come
+// before the image data go just before the palette or the first IDAT chunk, and any
+// other chunk goes just before the IEND chunk. Chunks inserted in the same place keep
+// the order they were inserted in
+func Insert(chunks []Chunk, chunk Chunk) []Chunk {
+	for i, c := range chunks {
+		if c.Type == "IEND" || beforeData[chunk.Type] && (c.Type == "PLTE" || c.Type == "IDAT") {
+			return append(chunks[:i:i], append([]Chunk{chunk}, chunks[i:]...)...)
+		}
+	}
+
+	return append(chunks, chunk)
+}
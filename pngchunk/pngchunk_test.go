@@ -0,0 +1,109 @@
+package pngchunk
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 3, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	chunks, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read() unexpected error %v", err)
+	}
+	var types []string
+	for _, chunk := range chunks {
+		types = append(types, chunk.Type)
+	}
+	if want := []string{"IHDR", "IDAT", "IEND"}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("Read() types = %v, want %v", types, want)
+	}
+
+	buf.Reset()
+	err = Write(&buf, chunks)
+	if err != nil {
+		t.Fatalf("Write() unexpected error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("Write() did not write the same png that was read")
+	}
+
+	// the png decoder checks the CRC of every chunk, including ones it does not know
+	chunks = Insert(chunks, Chunk{Type: "stEg", Data: []byte("hello")})
+	buf.Reset()
+	err = Write(&buf, chunks)
+	if err != nil {
+		t.Fatalf("Write() unexpected error %v", err)
+	}
+	_, err = png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("png.Decode() unexpected error %v", err)
+	}
+	got, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Read() unexpected error %v", err)
+	}
+	if chunk, ok := Find(got, "stEg"); !ok || string(chunk.Data) != "hello" || !chunk.Ancillary() {
+		t.Errorf("Find() = %v %t, want the stEg chunk", chunk, ok)
+	}
+	if got[len(got)-1].Type != "IEND" {
+		t.Errorf("Insert() put the chunk after IEND")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := bytes.Clone(buf.Bytes())
+	corrupted[len(signature)+8] ^= 1
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "not a png", data: []byte("GIF89a"), wantErr: ErrNotPNG},
+		{name: "bad crc", data: corrupted},
+		{name: "truncated", data: buf.Bytes()[:buf.Len()-12]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bytes.NewReader(tt.data))
+			if err == nil {
+				t.Fatalf("Read() expected an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Read() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInsert(t *testing.T) {
+	chunks := []Chunk{{Type: "IHDR"}, {Type: "PLTE"}, {Type: "IDAT"}, {Type: "IDAT"}, {Type: "IEND"}}
+	for _, chunkType := range []string{"tEXt", "gAMA", "stEg", "pHYs"} {
+		chunks = Insert(chunks, Chunk{Type: chunkType})
+	}
+
+	var got []string
+	for _, chunk := range chunks {
+		got = append(got, chunk.Type)
+	}
+	want := []string{"IHDR", "gAMA", "pHYs", "PLTE", "IDAT", "IDAT", "tEXt", "stEg", "IEND"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Insert() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package stego
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+)
+
+// Animation is an animated gif. Data is hidden in the samples of every frame in
+// order, as if the frames were one long paletted image. It implements image.Image by
+// showing its first frame so it can be used like any other carrier
+type Animation struct {
+	*gif.GIF
+}
+
+// ColorModel returns the color model of the first frame
+func (a *Animation) ColorModel() color.Model {
+	return a.Image[0].ColorModel()
+}
+
+// Bounds returns the bounds of the first frame
+func (a *Animation) Bounds() image.Rectangle {
+	return a.Image[0].Bounds()
+}
+
+// At returns the color of the first frame at x, y
+func (a *Animation) At(x, y int) color.Color {
+	return a.Image[0].At(x, y)
+}
+
+// DecodeGIF decodes every frame of a gif. Gifs with more than one frame are returned
+// as an Animation and anything else as a single paletted image
+func DecodeGIF(r io.Reader) (image.Image, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) == 1 {
+		return g.Image[0], nil
+	}
+
+	return &Animation{GIF: g}, nil
+}
+
+// animationSamples returns the samples of every frame of a, one after another
+func animationSamples(a *Animation) []uint8 {
+	var pix []uint8
+	for _, frame := range a.Image {
+		pix = append(pix, paletteSamples(frame)...)
+	}
+
+	return pix
+}
+
+// setAnimationSamples writes samples returned by animationSamples back to each frame
+func setAnimationSamples(a *Animation, pix []uint8) {
+	for _, frame := range a.Image {
+		setPaletteSamples(frame, pix[:len(frame.Pix)])
+		pix = pix[len(frame.Pix):]
+	}
+}
@@ -0,0 +1,68 @@
+package stego
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeGIF(t *testing.T) {
+	palette := color.Palette{color.Black, color.White, color.Gray{0x40}, color.Gray{0xC0}}
+	frames := []*image.Paletted{
+		image.NewPaletted(image.Rect(0, 0, 4, 2), palette),
+		image.NewPaletted(image.Rect(1, 1, 3, 2), palette),
+	}
+	for _, frame := range frames {
+		for i := range frame.Pix {
+			frame.Pix[i] = uint8(i % len(palette))
+		}
+	}
+
+	tests := []struct {
+		name   string
+		frames []*image.Paletted
+	}{
+		{name: "single frame", frames: frames[:1]},
+		{name: "animated", frames: frames},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := gif.EncodeAll(&buf, &gif.GIF{Image: tt.frames, Delay: make([]int, len(tt.frames))})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			img, err := DecodeGIF(&buf)
+			if err != nil {
+				t.Fatalf("DecodeGIF() unexpected error %v", err)
+			}
+			animation, isAnimation := img.(*Animation)
+			if isAnimation != (len(tt.frames) > 1) {
+				t.Fatalf("DecodeGIF() = %T, want %d frames", img, len(tt.frames))
+			}
+			if !isAnimation {
+				return
+			}
+
+			// every frame is used in order, and changes go back to the right frame
+			pix, format, err := Pixels(animation)
+			if err != nil {
+				t.Fatalf("Pixels() unexpected error %v", err)
+			}
+			want := []uint8{0, 3, 1, 2, 0, 3, 1, 2, 0, 3}
+			if format != FormatPaletted || !reflect.DeepEqual(pix, want) {
+				t.Fatalf("Pixels() = %v %d, want %v", pix, format, want)
+			}
+
+			pix[9] ^= 1
+			SetPixels(animation, pix)
+			if got := animation.Image[1].Pix; !reflect.DeepEqual(got, []uint8{0, 3}) {
+				t.Errorf("SetPixels() second frame = %v, want %v", got, []uint8{0, 3})
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package stego
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveMIME is the MIME type of envelopes that hold an archive
+const ArchiveMIME = "application/x-tar"
+
+// PackArchive packs the files at paths into a tar archive. Directories are added
+// along with everything inside them, and every member is named relative to the
+// directory that contains the path, so 'docs/README.md' stays under 'docs/'.
+// Only regular files and directories are supported
+func PackArchive(paths []string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	names := map[string]bool{}
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		parent := filepath.Dir(abs)
+
+		err = filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name, err := filepath.Rel(parent, path)
+			if err != nil {
+				return err
+			}
+			name = filepath.ToSlash(name)
+			if names[name] {
+				return fmt.Errorf("more than one file is named '%s'", name)
+			}
+			names[name] = true
+
+			return addArchiveFile(tw, path, name)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// addArchiveFile adds the file at path to the archive as name. Only the name, mode,
+// size and modification time are stored, owners are left out on purpose
+func addArchiveFile(tw *tar.Writer, path, name string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:    name,
+		Mode:    int64(info.Mode().Perm()),
+		ModTime: info.ModTime(),
+	}
+	switch {
+	case info.IsDir():
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+		return tw.WriteHeader(header)
+	case info.Mode().IsRegular():
+		header.Typeflag = tar.TypeReg
+		header.Size = info.Size()
+	default:
+		return fmt.Errorf("'%s' is not a regular file or directory", path)
+	}
+
+	err = tw.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// ListArchive returns the headers of every member of a tar archive
+func ListArchive(data []byte) ([]*tar.Header, error) {
+	var headers []*tar.Header
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return headers, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		headers = append(headers, header)
+	}
+}
+
+// ExtractArchive extracts every member of a tar archive into dir. Members that would
+// end up outside of dir are rejected, and existing files are never overwritten
+func ExtractArchive(dir string, data []byte) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// the root stops symlinks that already exist in dir from being followed out of it
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open output directory: %w", err)
+	}
+	defer root.Close()
+
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		name := filepath.FromSlash(strings.TrimSuffix(header.Name, "/"))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive member '%s' is outside of the output directory", header.Name)
+		}
+
+		err = root.MkdirAll(filepath.Dir(name), 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create directory for '%s': %w", header.Name, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = root.MkdirAll(name, 0o755)
+		case tar.TypeReg:
+			err = extractArchiveFile(root, name, header, tr)
+		default:
+			err = fmt.Errorf("unsupported member type '%c'", header.Typeflag)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract '%s': %w", header.Name, err)
+		}
+	}
+}
+
+// extractArchiveFile writes the contents of r to a new file called name inside root
+func extractArchiveFile(root *os.Root, name string, header *tar.Header, r io.Reader) error {
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fs.FileMode(header.Mode).Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return root.Chtimes(name, header.ModTime, header.ModTime)
+}
@@ -0,0 +1,160 @@
+package stego
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPackExtractArchive(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"config.yml":     "key: value",
+		"docs/README.md": "# Secret docs",
+	}
+	for name, data := range files {
+		path := filepath.Join(src, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(data), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := PackArchive([]string{filepath.Join(src, "config.yml"), filepath.Join(src, "docs")})
+	if err != nil {
+		t.Fatalf("PackArchive() unexpected error %v", err)
+	}
+
+	headers, err := ListArchive(data)
+	if err != nil {
+		t.Fatalf("ListArchive() unexpected error %v", err)
+	}
+	var names []string
+	for _, header := range headers {
+		names = append(names, header.Name)
+	}
+	wantNames := []string{"config.yml", "docs/", "docs/README.md"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("ListArchive() names = %v, want %v", names, wantNames)
+	}
+
+	dst := t.TempDir()
+	err = ExtractArchive(dst, data)
+	if err != nil {
+		t.Fatalf("ExtractArchive() unexpected error %v", err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("ExtractArchive() did not extract %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("ExtractArchive() %s = %q, want %q", name, got, want)
+		}
+	}
+
+	err = ExtractArchive(dst, data)
+	if err == nil {
+		t.Errorf("ExtractArchive() expected an error when overwriting files")
+	}
+}
+
+func TestPackArchiveDuplicateNames(t *testing.T) {
+	src := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		err := os.Mkdir(filepath.Join(src, dir), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(src, dir, "secret.dat"), []byte(dir), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := PackArchive([]string{filepath.Join(src, "a", "secret.dat"), filepath.Join(src, "b", "secret.dat")})
+	if err == nil {
+		t.Errorf("PackArchive() expected an error for duplicate names")
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	type args struct {
+		headers []*tar.Header
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "file in a new directory",
+			args: args{headers: []*tar.Header{
+				{Name: "docs/README.md", Typeflag: tar.TypeReg, Mode: 0o644},
+			}},
+			wantErr: false,
+		},
+		{
+			name: "parent directory",
+			args: args{headers: []*tar.Header{
+				{Name: "../evil.sh", Typeflag: tar.TypeReg, Mode: 0o755},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "escapes through a directory",
+			args: args{headers: []*tar.Header{
+				{Name: "docs/../../evil.sh", Typeflag: tar.TypeReg, Mode: 0o755},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "absolute path",
+			args: args{headers: []*tar.Header{
+				{Name: "/tmp/evil.sh", Typeflag: tar.TypeReg, Mode: 0o755},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "symlink",
+			args: args{headers: []*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, header := range tt.args.headers {
+				err := tw.WriteHeader(header)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := tw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := filepath.Join(t.TempDir(), "out")
+			err = ExtractArchive(dir, buf.Bytes())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExtractArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			_, err = os.Stat(filepath.Join(dir, "..", "evil.sh"))
+			if err == nil {
+				t.Errorf("ExtractArchive() wrote a file outside of the output directory")
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package stego
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressDecompress(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "text", data: []byte("Here's the hidden data")},
+		{name: "repeated", data: bytes.Repeat([]byte(`{"key": "value"}`), 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := Compress(tt.data)
+			if err != nil {
+				t.Fatalf("Compress() unexpected error %v", err)
+			}
+
+			got, err := Decompress(compressed)
+			if err != nil {
+				t.Fatalf("Decompress() unexpected error %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("Decompress() = %q, want %q", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestDecompressInvalid(t *testing.T) {
+	_, err := Decompress([]byte{0xFF, 0xFF, 0xFF})
+	if err == nil {
+		t.Errorf("Decompress() expected an error for invalid data")
+	}
+}
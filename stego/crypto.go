@@ -0,0 +1,124 @@
+package stego
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	// saltSize is the size of the random salt used to derive a key from a password
+	saltSize = 16
+	// kdfIterations is the number of PBKDF2 iterations used to derive a key
+	kdfIterations = 600_000
+)
+
+// ErrAuthentication is returned when encrypted data can not be decrypted, either
+// because the password is wrong or the data was changed
+var ErrAuthentication = errors.New("authentication failed: wrong password or corrupted data")
+
+// ErrPasswordRequired is returned when trying to read encrypted data without a password
+var ErrPasswordRequired = errors.New("the hidden data is encrypted, a password is required")
+
+// Seal encrypts data with AES-GCM using a key derived from password. The random salt
+// and nonce are stored in the header so Open can decrypt the data later. The header's
+// flags must already be set since they are authenticated along with the data
+func Seal(header *Header, password string, data []byte) ([]byte, error) {
+	key, err := NewPasswordKey(password)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.Seal(header, data)
+}
+
+// PasswordKey is a key derived from a password with a random salt. Deriving the key is
+// slow on purpose, so a PasswordKey can be used to seal data more than once without
+// deriving it again
+type PasswordKey struct {
+	salt []byte
+	aead cipher.AEAD
+}
+
+// NewPasswordKey derives a key from password with a new random salt
+func NewPasswordKey(password string) (*PasswordKey, error) {
+	salt := make([]byte, saltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	aead, err := newAEAD(password, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasswordKey{salt: salt, aead: aead}, nil
+}
+
+// Seal encrypts data like the Seal function, every call uses a new random nonce
+func (k *PasswordKey) Seal(header *Header, data []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header.Flags |= FlagEncrypted
+	header.Salt = k.salt
+	header.Nonce = nonce
+	return k.aead.Seal(nil, nonce, data, additionalData(*header)), nil
+}
+
+// Open decrypts data that was encrypted by Seal using the salt and nonce in the header
+func Open(header Header, password string, data []byte) ([]byte, error) {
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+
+	aead, err := newAEAD(password, header.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(header.Nonce))
+	}
+
+	plain, err := aead.Open(nil, header.Nonce, data, additionalData(header))
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+
+	return plain, nil
+}
+
+// newAEAD creates an AES-256-GCM cipher using a key derived from password and salt
+func newAEAD(password string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, password, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	return newGCM(key)
+}
+
+// newGCM creates an AES-GCM cipher using key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// additionalData returns the part of the header that is authenticated along with the
+// encrypted data. The flags decide how the data is decoded so they can't be changed,
+// apart from FlagChecksum which is only set once the data is encrypted
+func additionalData(header Header) []byte {
+	return []byte{header.Flags &^ FlagChecksum}
+}
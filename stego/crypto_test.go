@@ -0,0 +1,124 @@
+package stego
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	type args struct {
+		password string
+		change   func(header *Header, sealed []byte)
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name: "correct password",
+			args: args{
+				password: "hunter2",
+			},
+			wantErr: nil,
+		},
+		{
+			name: "wrong password",
+			args: args{
+				password: "hunter3",
+			},
+			wantErr: ErrAuthentication,
+		},
+		{
+			name: "missing password",
+			args: args{
+				password: "",
+			},
+			wantErr: ErrPasswordRequired,
+		},
+		{
+			name: "changed data",
+			args: args{
+				password: "hunter2",
+				change: func(header *Header, sealed []byte) {
+					sealed[0] ^= 0x01
+				},
+			},
+			wantErr: ErrAuthentication,
+		},
+		{
+			name: "changed flags",
+			args: args{
+				password: "hunter2",
+				change: func(header *Header, sealed []byte) {
+					header.Flags ^= FlagTransparent
+				},
+			},
+			wantErr: ErrAuthentication,
+		},
+		{
+			name: "checksum added after sealing",
+			args: args{
+				password: "hunter2",
+				change: func(header *Header, sealed []byte) {
+					header.SetChecksum(sealed)
+				},
+			},
+			wantErr: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("Here's the hidden data")
+			header := Header{Version: Version, Depth: 1, Channels: RGB}
+			sealed, err := Seal(&header, "hunter2", data)
+			if err != nil {
+				t.Fatalf("Seal() unexpected error %v", err)
+			}
+			if header.Flags&FlagEncrypted == 0 {
+				t.Fatalf("Seal() did not set FlagEncrypted")
+			}
+			if tt.args.change != nil {
+				tt.args.change(&header, sealed)
+			}
+
+			got, err := Open(header, tt.args.password, sealed)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(got, data) {
+				t.Errorf("Open() = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestPasswordKey(t *testing.T) {
+	key, err := NewPasswordKey("hunter2")
+	if err != nil {
+		t.Fatalf("NewPasswordKey() unexpected error %v", err)
+	}
+
+	var nonces [][]byte
+	for _, data := range [][]byte{[]byte("Here's the hidden data"), []byte("Here's more hidden data")} {
+		header := Header{Version: Version, Depth: 1, Channels: RGB}
+		sealed, err := key.Seal(&header, data)
+		if err != nil {
+			t.Fatalf("Seal() unexpected error %v", err)
+		}
+
+		got, err := Open(header, "hunter2", sealed)
+		if err != nil {
+			t.Fatalf("Open() unexpected error %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Open() = %q, want %q", got, data)
+		}
+		nonces = append(nonces, header.Nonce)
+	}
+
+	if bytes.Equal(nonces[0], nonces[1]) {
+		t.Errorf("Seal() reused nonce %x", nonces[0])
+	}
+}
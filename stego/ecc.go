@@ -0,0 +1,170 @@
+package stego
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bjatkin/imgdemo/bits"
+)
+
+// ecc redundancy levels, the number of Reed-Solomon parity bytes added to each
+// block of at most 255 bytes. Each level corrects up to half that many bad bytes
+// in every block
+var eccLevels = []struct {
+	name   string
+	parity uint8
+}{
+	{"none", 0},
+	{"low", 16},
+	{"medium", 32},
+	{"high", 64},
+}
+
+const (
+	// headerRepeat is the number of copies of a header that are written when the data
+	// uses error correction, so the header can survive the same damage as the data
+	headerRepeat = 3
+	// headerChunk is the number of bytes of the header that are repeated at a time.
+	// Each chunk is written headerRepeat times in a row, so the copies of a bit are
+	// far enough apart that one damaged pixel can not reach more than one of them
+	headerChunk = 8
+)
+
+// ParseECC parses an error correction level, one of none, low, medium or high, and
+// returns the number of parity bytes it adds to each block
+func ParseECC(s string) (uint8, error) {
+	var names []string
+	for _, level := range eccLevels {
+		if strings.EqualFold(s, level.name) {
+			return level.parity, nil
+		}
+		names = append(names, level.name)
+	}
+
+	return 0, fmt.Errorf("ecc must be one of %s", strings.Join(names, ", "))
+}
+
+// EncodeECC splits data into blocks and adds parity bytes to each of them. The
+// blocks are interleaved byte by byte so damage to a run of samples is spread over
+// every block rather than overwhelming just one
+func EncodeECC(data []byte, parity uint8) ([]byte, error) {
+	blocks := eccBlocks(len(data), parity)
+	codewords := make([][]byte, len(blocks))
+	for i, size := range blocks {
+		block := data[:size]
+		data = data[size:]
+
+		parityData, err := bits.RSEncode(block, int(parity))
+		if err != nil {
+			return nil, err
+		}
+		codewords[i] = append(block[:len(block):len(block)], parityData...)
+	}
+
+	return interleave(codewords), nil
+}
+
+// DecodeECC undoes EncodeECC, correcting errors in each block. It returns the data
+// and the number of bytes that were corrected
+func DecodeECC(coded []byte, parity uint8) ([]byte, int, error) {
+	length := eccDataLength(len(coded), parity)
+	if length < 0 {
+		return nil, 0, fmt.Errorf("%w: invalid error corrected length %d", ErrCorrupted, len(coded))
+	}
+
+	blocks := eccBlocks(length, parity)
+	sizes := make([]int, len(blocks))
+	for i, size := range blocks {
+		sizes[i] = size + int(parity)
+	}
+	codewords := deinterleave(coded, sizes)
+
+	data := make([]byte, 0, length)
+	corrected := 0
+	for i, codeword := range codewords {
+		n, err := bits.RSDecode(codeword, int(parity))
+		if err != nil {
+			return nil, corrected, fmt.Errorf("%w: block %d: %v", ErrCorrupted, i, err)
+		}
+		corrected += n
+		data = append(data, codeword[:blocks[i]]...)
+	}
+
+	return data, corrected, nil
+}
+
+// ECCLength returns the length of length bytes of data once parity is added
+func ECCLength(length int, parity uint8) int {
+	return length + len(eccBlocks(length, parity))*int(parity)
+}
+
+// ECCCapacity returns the most data that fits in capacity bytes once parity is added
+func ECCCapacity(capacity int, parity uint8) int {
+	blocks := (capacity + bits.MaxCodeword - 1) / bits.MaxCodeword
+	return max(capacity-blocks*int(parity), 0)
+}
+
+// eccBlocks returns the size of each data block, the blocks are as close to the same
+// size as possible so each one gets the same protection
+func eccBlocks(length int, parity uint8) []int {
+	perBlock := bits.MaxCodeword - int(parity)
+	count := (length + perBlock - 1) / perBlock
+	blocks := make([]int, count)
+	for i := range blocks {
+		blocks[i] = length / count
+		if i < length%count {
+			blocks[i]++
+		}
+	}
+
+	return blocks
+}
+
+// eccDataLength returns the data length that EncodeECC turns into coded bytes, or -1
+// if no data length does
+func eccDataLength(coded int, parity uint8) int {
+	count := (coded + bits.MaxCodeword - 1) / bits.MaxCodeword
+	length := coded - count*int(parity)
+	if length < count || ECCLength(length, parity) != coded {
+		return -1
+	}
+
+	return length
+}
+
+// interleave writes the first byte of every codeword, then the second byte of every
+// codeword and so on, skipping codewords that are too short
+func interleave(codewords [][]byte) []byte {
+	var out []byte
+	for i := 0; ; i++ {
+		done := true
+		for _, codeword := range codewords {
+			if i < len(codeword) {
+				out = append(out, codeword[i])
+				done = false
+			}
+		}
+		if done {
+			return out
+		}
+	}
+}
+
+// deinterleave undoes interleave given the size of each codeword
+func deinterleave(data []byte, sizes []int) [][]byte {
+	codewords := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		codewords[i] = make([]byte, 0, size)
+	}
+
+	for i := 0; len(data) > 0; i++ {
+		for j, size := range sizes {
+			if i < size {
+				codewords[j] = append(codewords[j], data[0])
+				data = data[1:]
+			}
+		}
+	}
+
+	return codewords
+}
@@ -0,0 +1,95 @@
+package stego
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestECC(t *testing.T) {
+	type args struct {
+		length int
+		parity uint8
+		flips  []int
+	}
+	tests := []struct {
+		name          string
+		args          args
+		wantCorrected int
+		wantErr       error
+	}{
+		{
+			name: "empty",
+			args: args{length: 0, parity: 16},
+		},
+		{
+			name: "single block",
+			args: args{length: 100, parity: 16, flips: []int{0, 50, 99}},
+			// each flipped byte is in the same block
+			wantCorrected: 3,
+		},
+		{
+			name: "several blocks",
+			args: args{length: 2000, parity: 32, flips: []int{1, 500, 501, 502, 1999}},
+			// interleaving puts a run of damaged bytes into different blocks
+			wantCorrected: 5,
+		},
+		{
+			name: "burst spread over blocks",
+			args: args{length: 1000, parity: 16, flips: []int{
+				100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111, 112, 113, 114, 115,
+				116, 117, 118, 119, 120, 121, 122, 123, 124, 125, 126, 127, 128, 129, 130, 131,
+			}},
+			wantCorrected: 32,
+		},
+		{
+			name:    "too much damage",
+			args:    args{length: 100, parity: 4, flips: []int{0, 1, 2}},
+			wantErr: ErrCorrupted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.args.length)
+			for i := range data {
+				data[i] = byte(i * 7)
+			}
+
+			coded, err := EncodeECC(data, tt.args.parity)
+			if err != nil {
+				t.Fatalf("EncodeECC() unexpected error %v", err)
+			}
+			if len(coded) != ECCLength(len(data), tt.args.parity) {
+				t.Errorf("EncodeECC() length = %d, want %d", len(coded), ECCLength(len(data), tt.args.parity))
+			}
+			for _, flip := range tt.args.flips {
+				coded[flip] ^= 0xFF
+			}
+
+			got, corrected, err := DecodeECC(coded, tt.args.parity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeECC() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if corrected != tt.wantCorrected {
+				t.Errorf("DecodeECC() corrected = %d, want %d", corrected, tt.wantCorrected)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("DecodeECC() did not restore the data")
+			}
+		})
+	}
+}
+
+func TestECCCapacity(t *testing.T) {
+	for _, parity := range []uint8{16, 32, 64} {
+		for capacity := 0; capacity < 2000; capacity++ {
+			length := ECCCapacity(capacity, parity)
+			if ECCLength(length, parity) > capacity {
+				t.Fatalf("ECCCapacity(%d, %d) = %d which needs %d bytes", capacity, parity, length, ECCLength(length, parity))
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package stego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// maxNameSize is the longest file name or MIME type an envelope can store
+const maxNameSize = 4096
+
+// Envelope wraps hidden data with information about the file it was read from so
+// the file can be restored when the data is found
+type Envelope struct {
+	Name    string
+	Mode    fs.FileMode
+	ModTime time.Time
+	MIME    string
+	Data    []byte
+
+	// Archive is set when Data is a tar archive created by PackArchive. It's stored
+	// as a header flag rather than in the envelope itself
+	Archive bool
+}
+
+// MarshalBinary encodes the envelope in the following layout
+//
+//	name     uvarint length + bytes
+//	size     uvarint
+//	mode     uvarint
+//	modtime  varint unix nanoseconds, 0 when unknown
+//	mime     uvarint length + bytes
+//	data     [size]byte
+func (e Envelope) MarshalBinary() ([]byte, error) {
+	if len(e.Name) > maxNameSize || len(e.MIME) > maxNameSize {
+		return nil, errors.New("file name or MIME type is too long")
+	}
+
+	var buf []byte
+	buf = appendString(buf, e.Name)
+	buf = binary.AppendUvarint(buf, uint64(len(e.Data)))
+	buf = binary.AppendUvarint(buf, uint64(e.Mode.Perm()))
+	buf = binary.AppendVarint(buf, unixNano(e.ModTime))
+	buf = appendString(buf, e.MIME)
+	buf = append(buf, e.Data...)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes an envelope encoded by MarshalBinary
+func (e *Envelope) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	name, err := readString(r)
+	if err != nil {
+		return fmt.Errorf("failed to read file name: %w", err)
+	}
+
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("failed to read file size: %w", err)
+	}
+
+	mode, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("failed to read file mode: %w", err)
+	}
+
+	modTime, err := binary.ReadVarint(r)
+	if err != nil {
+		return fmt.Errorf("failed to read modification time: %w", err)
+	}
+
+	mime, err := readString(r)
+	if err != nil {
+		return fmt.Errorf("failed to read MIME type: %w", err)
+	}
+
+	if size != uint64(r.Len()) {
+		return fmt.Errorf("file size %d does not match the %d bytes of data", size, r.Len())
+	}
+
+	*e = Envelope{
+		Name:    name,
+		Mode:    fs.FileMode(mode).Perm(),
+		ModTime: fromUnixNano(modTime),
+		MIME:    mime,
+		Data:    data[len(data)-r.Len():],
+	}
+	return nil
+}
+
+// unixNano converts t to unix nanoseconds, the zero time is stored as 0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+// fromUnixNano converts unix nanoseconds back to a time, 0 is the zero time
+func fromUnixNano(nano int64) time.Time {
+	if nano == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nano)
+}
+
+// appendString appends a length prefixed string to buf
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// readString reads a length prefixed string from r
+func readString(r *bytes.Reader) (string, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if size > maxNameSize {
+		return "", fmt.Errorf("string of length %d is too long", size)
+	}
+
+	s := make([]byte, size)
+	_, err = io.ReadFull(r, s)
+	if err != nil {
+		return "", err
+	}
+
+	return string(s), nil
+}
@@ -0,0 +1,91 @@
+package stego
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope Envelope
+	}{
+		{
+			name:     "data only",
+			envelope: Envelope{Data: []byte("Here's the hidden data")},
+		},
+		{
+			name: "file",
+			envelope: Envelope{
+				Name:    "secret.dat",
+				Mode:    0o640,
+				ModTime: time.Date(2024, 8, 31, 10, 12, 44, 5, time.Local),
+				MIME:    "text/plain; charset=utf-8",
+				Data:    []byte("Here's the hidden data"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.envelope.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary() unexpected error %v", err)
+			}
+
+			var got Envelope
+			err = got.UnmarshalBinary(data)
+			if err != nil {
+				t.Fatalf("UnmarshalBinary() unexpected error %v", err)
+			}
+			if !got.ModTime.Equal(tt.envelope.ModTime) {
+				t.Errorf("UnmarshalBinary() ModTime = %v, want %v", got.ModTime, tt.envelope.ModTime)
+			}
+			got.ModTime = tt.envelope.ModTime
+			if !reflect.DeepEqual(got, tt.envelope) {
+				t.Errorf("UnmarshalBinary() = %+v, want %+v", got, tt.envelope)
+			}
+		})
+	}
+}
+
+func TestEnvelopeUnmarshalBinary(t *testing.T) {
+	type args struct {
+		data []byte
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			args:    args{data: []byte{}},
+			wantErr: true,
+		},
+		{
+			name:    "truncated name",
+			args:    args{data: []byte{0x05, 'a', 'b'}},
+			wantErr: true,
+		},
+		{
+			name:    "size does not match",
+			args:    args{data: []byte{0x00, 0x03, 0x00, 0x00, 0x00, 'a'}},
+			wantErr: true,
+		},
+		{
+			name:    "valid",
+			args:    args{data: []byte{0x01, 'a', 0x01, 0x00, 0x00, 0x00, 'a'}},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e Envelope
+			err := e.UnmarshalBinary(tt.args.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UnmarshalBinary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package stego
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// Format is the way samples are stored in an image's pixel data
+type Format uint8
+
+const (
+	// FormatNRGBA has four 8 bit samples per pixel
+	FormatNRGBA Format = iota
+	// FormatNRGBA64 has four 16 bit samples per pixel
+	FormatNRGBA64
+	// FormatGray has one 8 bit gray sample per pixel
+	FormatGray
+	// FormatGray16 has one 16 bit gray sample per pixel
+	FormatGray16
+	// FormatPaletted has one sample per pixel, the position of the pixel's color in
+	// the palette sorted by luminance, see palette.go
+	FormatPaletted
+	// FormatJPEG has one sample per AC coefficient of a jpeg image, see jpeg.go
+	FormatJPEG
+)
+
+// Single reports whether the format has a single sample per pixel, so there are no
+// channels to pick and no transparency to skip
+func (f Format) Single() bool {
+	return f == FormatGray || f == FormatGray16 || f == FormatPaletted || f == FormatJPEG
+}
+
+// samples returns the number of samples in each pixel
+func (f Format) samples() int {
+	if f.Single() {
+		return 1
+	}
+
+	return 4
+}
+
+// size returns the number of bytes used by each sample. 16 bit samples are stored
+// big endian, so data is only ever hidden in their second byte
+func (f Format) size() int {
+	if f == FormatNRGBA64 || f == FormatGray16 {
+		return 2
+	}
+
+	return 1
+}
+
+// Pixels returns the pixel data of img along with its format. Only the image types
+// returned by Carrier are supported. The samples of paletted and jpeg images are a copy
+// of their data, so they must be written back with SetPixels once data is hidden in
+// them
+func Pixels(img image.Image) ([]uint8, Format, error) {
+	switch img := img.(type) {
+	case *image.NRGBA:
+		return img.Pix, FormatNRGBA, nil
+	case *image.NRGBA64:
+		return img.Pix, FormatNRGBA64, nil
+	case *image.Gray:
+		return img.Pix, FormatGray, nil
+	case *image.Gray16:
+		return img.Pix, FormatGray16, nil
+	case *image.Paletted:
+		return paletteSamples(img), FormatPaletted, nil
+	case *Animation:
+		return animationSamples(img), FormatPaletted, nil
+	case *JPEG:
+		return jpegSamples(img), FormatJPEG, nil
+	default:
+		return nil, 0, fmt.Errorf("can not hide data in %T images", img)
+	}
+}
+
+// Stride returns the number of bytes between rows of the pixel data Pixels returns for
+// img. Animations and jpegs have no single grid of pixels, so it returns 0 for them
+func Stride(img image.Image) int {
+	switch img := img.(type) {
+	case *image.NRGBA:
+		return img.Stride
+	case *image.NRGBA64:
+		return img.Stride
+	case *image.Gray:
+		return img.Stride
+	case *image.Gray16:
+		return img.Stride
+	case *image.Paletted:
+		return img.Stride
+	default:
+		return 0
+	}
+}
+
+// SetPixels writes samples returned by Pixels, and changed since, back to img. Only
+// paletted images, animations and jpegs need this, it does nothing for any other image
+func SetPixels(img image.Image, pix []uint8) {
+	switch img := img.(type) {
+	case *image.Paletted:
+		setPaletteSamples(img, pix)
+	case *Animation:
+		setAnimationSamples(img, pix)
+	case *JPEG:
+		setJPEGSamples(img, pix)
+	}
+}
+
+// Carrier returns img as an image that data can be hidden in, without changing any of
+// its samples. NRGBA, NRGBA64, Gray, Gray16 and paletted images, animations and jpegs
+// are returned as they are. Opaque RGBA and RGBA64 images, which is how the png decoder
+// returns images without an alpha channel, are converted to NRGBA and NRGBA64. It
+// returns false for any other image
+func Carrier(img image.Image) (image.Image, bool) {
+	switch img := img.(type) {
+	case *image.NRGBA, *image.NRGBA64, *image.Gray, *image.Gray16, *image.Paletted, *Animation, *JPEG:
+		return img, true
+	case *image.RGBA:
+		if !img.Opaque() {
+			return nil, false
+		}
+		nrgba := image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, img.Bounds(), img, img.Bounds().Min, draw.Src)
+		return nrgba, true
+	case *image.RGBA64:
+		if !img.Opaque() {
+			return nil, false
+		}
+		nrgba := image.NewNRGBA64(img.Bounds())
+		draw.Draw(nrgba, img.Bounds(), img, img.Bounds().Min, draw.Src)
+		return nrgba, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,88 @@
+package stego
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestCarrier(t *testing.T) {
+	opaque := image.NewRGBA64(image.Rect(0, 0, 2, 1))
+	opaque.SetRGBA64(0, 0, color.RGBA64{0x1234, 0x5678, 0x9ABC, 0xFFFF})
+	opaque.SetRGBA64(1, 0, color.RGBA64{0x0001, 0x0002, 0x0003, 0xFFFF})
+	translucent := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	translucent.SetRGBA(0, 0, color.RGBA{0x10, 0x10, 0x10, 0x80})
+
+	tests := []struct {
+		name   string
+		img    image.Image
+		want   []uint8
+		format Format
+		ok     bool
+	}{
+		{
+			name:   "gray",
+			img:    &image.Gray{Pix: []uint8{1, 2, 3}, Stride: 3, Rect: image.Rect(0, 0, 3, 1)},
+			want:   []uint8{1, 2, 3},
+			format: FormatGray,
+			ok:     true,
+		},
+		{
+			name:   "gray16",
+			img:    &image.Gray16{Pix: []uint8{1, 2, 3, 4}, Stride: 4, Rect: image.Rect(0, 0, 2, 1)},
+			want:   []uint8{1, 2, 3, 4},
+			format: FormatGray16,
+			ok:     true,
+		},
+		{
+			name: "opaque rgba64",
+			img:  opaque,
+			want: []uint8{
+				0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC, 0xFF, 0xFF,
+				0x00, 0x01, 0x00, 0x02, 0x00, 0x03, 0xFF, 0xFF,
+			},
+			format: FormatNRGBA64,
+			ok:     true,
+		},
+		{
+			name: "translucent rgba",
+			img:  translucent,
+			ok:   false,
+		},
+		{
+			name:   "paletted",
+			img:    &image.Paletted{Pix: []uint8{0, 1, 2}, Stride: 3, Rect: image.Rect(0, 0, 3, 1), Palette: color.Palette{color.White, color.Black, color.Gray{0x80}}},
+			want:   []uint8{0xFF, 0, 1},
+			format: FormatPaletted,
+			ok:     true,
+		},
+		{
+			name: "ycbcr",
+			img:  image.NewYCbCr(image.Rect(0, 0, 1, 1), image.YCbCrSubsampleRatio444),
+			ok:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, ok := Carrier(tt.img)
+			if ok != tt.ok {
+				t.Fatalf("Carrier() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+
+			pix, format, err := Pixels(img)
+			if err != nil {
+				t.Fatalf("Pixels() unexpected error %v", err)
+			}
+			if format != tt.format {
+				t.Errorf("Pixels() format = %d, want %d", format, tt.format)
+			}
+			if !reflect.DeepEqual(pix, tt.want) {
+				t.Errorf("Pixels() = %v, want %v", pix, tt.want)
+			}
+		})
+	}
+}
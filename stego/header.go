@@ -0,0 +1,511 @@
+package stego
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/bjatkin/imgdemo/bits"
+)
+
+const (
+	// MagicNumber is the magic number that indicates that there is a versioned
+	// header hidden in this image
+	MagicNumber uint16 = 0xB175
+
+	// LegacyMagicNumber is the magic number used by the original v0 layout, where it
+	// was followed by a uint16 data length and then the data itself
+	LegacyMagicNumber uint16 = 0x1337
+
+	// RobustMagicNumber is the magic number of versioned headers that have every bit
+	// repeated so they can be read even when a few bits were flipped. It's used
+	// when the data has error correction
+	RobustMagicNumber uint16 = 0xB176
+
+	// Version is the current header format version written by the hide command
+	Version uint8 = 1
+
+	// ChunkType is the private ancillary png chunk that holds a header followed by its
+	// data when they are stored next to the pixels rather than hidden in them
+	ChunkType = "stEg"
+)
+
+// field tags for the optional values stored at the end of a versioned header
+const (
+	fieldEnd uint8 = iota
+	fieldDepth
+	fieldChannels
+	fieldSalt
+	fieldNonce
+	fieldChecksum
+	fieldShard
+	fieldParity
+	fieldTexture
+	fieldMatrix
+	fieldEphemeral
+	fieldRecipient
+)
+
+// header flags
+const (
+	// FlagTransparent is set when fully transparent pixels were used to hide data
+	FlagTransparent uint8 = 1 << iota
+	// FlagEncrypted is set when the data was encrypted with a password or for recipients
+	FlagEncrypted
+	// FlagScattered is set when the header and data were scattered over the image
+	// using a key
+	FlagScattered
+	// FlagCompressed is set when the data was compressed before it was hidden
+	FlagCompressed
+	// FlagChecksum is set when the header has a checksum of the hidden data
+	FlagChecksum
+	// FlagEnvelope is set when the hidden data is an Envelope
+	FlagEnvelope
+	// FlagArchive is set when the envelope holds a tar archive of several files
+	FlagArchive
+)
+
+// ErrNoPayload is returned when no hidden data could be found in an image
+var ErrNoPayload = errors.New("no hidden data found: magic number does not match")
+
+// ErrCorrupted is returned when hidden data was found but it has been damaged, for
+// example because the image was edited or saved in a lossy format
+var ErrCorrupted = errors.New("hidden data is corrupted")
+
+// Header describes the data hidden in an image. Version 0 headers are read from the
+// legacy layout and only ever carry a length.
+// The header itself is always hidden using 1 bit per sample, the data that follows
+// it uses Depth bits per sample. Both use the samples picked by the header's Layout
+type Header struct {
+	Version  uint8
+	Flags    uint8
+	Length   uint64
+	Depth    uint8
+	Channels Channels
+
+	// Salt and Nonce are used to decrypt the data when FlagEncrypted is set
+	Salt  []byte
+	Nonce []byte
+
+	// Ephemeral and Recipients replace Salt when the data was encrypted for public keys
+	// rather than with a password, see SealFor. Recipients holds the message key
+	// wrapped for each recipient
+	Ephemeral  []byte
+	Recipients [][]byte
+
+	// Checksum is the CRC-32 of the hidden data when FlagChecksum is set
+	Checksum uint32
+
+	// Shard describes which part of a payload split across several images the
+	// data is, it's the zero value when the payload is in a single image
+	Shard Shard
+
+	// Parity is the number of error correction bytes added to each block of data, the
+	// data has no error correction when it's 0. Length counts the parity bytes
+	Parity uint8
+
+	// Texture is the lowest texture score of the pixels the data is hidden in, see
+	// Layout. The header itself is always hidden without checking texture
+	Texture uint8
+
+	// Matrix is the number of bits hidden in each group of 2^Matrix-1 samples with
+	// matrix embedding, see Writer. It's 0 when every sample holds Depth bits, and
+	// can only be set with a Depth of 1. The header itself never uses matrix embedding
+	Matrix uint8
+}
+
+// Layout returns the layout that the header and its data are hidden with. The key
+// is never stored in the header so it must be passed in, it's only used if the
+// header is scattered
+func (h Header) Layout(key string) Layout {
+	if h.Version == 0 {
+		return LegacyLayout
+	}
+
+	layout := Layout{
+		Channels:    h.Channels,
+		Transparent: h.Flags&FlagTransparent != 0,
+	}
+	if h.Flags&FlagScattered != 0 {
+		layout.Key = key
+	}
+
+	return layout
+}
+
+// MarshalBinary encodes the header, including the magic number, in the following layout
+//
+//	magic   uint16
+//	version uint8
+//	flags   uint8
+//	length  uvarint
+//	fields  (tag uint8, size uvarint, value [size]byte)... terminated by a 0 tag
+//
+// the field list lets newer versions of the format add values without changing the
+// position of the ones that came before them. Headers with Parity set use
+// RobustMagicNumber, and are padded to a multiple of 8 bytes with every 8 byte
+// chunk written 3 times
+func (h Header) MarshalBinary() ([]byte, error) {
+	if h.Version != Version {
+		return nil, fmt.Errorf("can not write header version %d", h.Version)
+	}
+	if h.Depth < 1 || h.Depth > MaxDepth {
+		return nil, fmt.Errorf("depth must be between 1 and %d", MaxDepth)
+	}
+	if h.Channels == 0 || h.Channels > RGBA {
+		return nil, fmt.Errorf("invalid channels %d", h.Channels)
+	}
+
+	magic := MagicNumber
+	if h.Parity != 0 {
+		magic = RobustMagicNumber
+	}
+
+	buf := binary.BigEndian.AppendUint16(nil, magic)
+	buf = append(buf, h.Version, h.Flags)
+	buf = binary.AppendUvarint(buf, h.Length)
+
+	// fields are only written when they differ from their default value
+	if h.Depth != 1 {
+		buf = appendField(buf, fieldDepth, []byte{h.Depth})
+	}
+	if h.Channels != RGB {
+		buf = appendField(buf, fieldChannels, []byte{uint8(h.Channels)})
+	}
+	if h.Flags&FlagEncrypted != 0 && h.Ephemeral == nil {
+		buf = appendField(buf, fieldSalt, h.Salt)
+		buf = appendField(buf, fieldNonce, h.Nonce)
+	}
+	if h.Flags&FlagEncrypted != 0 && h.Ephemeral != nil {
+		// each recipient gets a field of its own so there can be any number of them
+		buf = appendField(buf, fieldNonce, h.Nonce)
+		buf = appendField(buf, fieldEphemeral, h.Ephemeral)
+		for _, recipient := range h.Recipients {
+			buf = appendField(buf, fieldRecipient, recipient)
+		}
+	}
+	if h.Flags&FlagChecksum != 0 {
+		buf = appendField(buf, fieldChecksum, binary.BigEndian.AppendUint32(nil, h.Checksum))
+	}
+	if h.Shard.Total != 0 {
+		if h.Shard.Index >= h.Shard.Total {
+			return nil, fmt.Errorf("shard index %d is out of range for %d shards", h.Shard.Index, h.Shard.Total)
+		}
+		buf = appendField(buf, fieldShard, h.Shard.marshal())
+	}
+	if h.Parity != 0 {
+		if int(h.Parity) >= bits.MaxCodeword {
+			return nil, fmt.Errorf("invalid parity %d", h.Parity)
+		}
+		buf = appendField(buf, fieldParity, []byte{h.Parity})
+	}
+	if h.Texture != 0 {
+		buf = appendField(buf, fieldTexture, []byte{h.Texture})
+	}
+	if h.Matrix != 0 {
+		if h.Matrix < 2 || h.Matrix > MaxMatrix || h.Depth != 1 {
+			return nil, fmt.Errorf("invalid matrix embedding of %d bits at depth %d", h.Matrix, h.Depth)
+		}
+		buf = appendField(buf, fieldMatrix, []byte{h.Matrix})
+	}
+
+	buf = append(buf, fieldEnd)
+	if h.Parity != 0 {
+		return repeatHeader(buf), nil
+	}
+	return buf, nil
+}
+
+// SetChecksum stores the checksum of data in the header
+func (h *Header) SetChecksum(data []byte) {
+	h.Flags |= FlagChecksum
+	h.Checksum = crc32.ChecksumIEEE(data)
+}
+
+// Verify checks data against the header's checksum, it returns ErrCorrupted if they
+// do not match. Headers without a checksum can not be verified and always pass
+func (h Header) Verify(data []byte) error {
+	if h.Flags&FlagChecksum == 0 {
+		return nil
+	}
+	if crc32.ChecksumIEEE(data) != h.Checksum {
+		return ErrCorrupted
+	}
+
+	return nil
+}
+
+// Capacity returns the largest data length, in bytes, that can be hidden along with
+// this header in the given number of usable samples. When the header has Parity set
+// the capacity is the length before the parity bytes are added
+func (h Header) Capacity(samples int) int {
+	h.Length = uint64(samples * int(h.Depth) / 8)
+	headerData, err := h.MarshalBinary()
+	if err != nil {
+		return 0
+	}
+
+	// the header only gets smaller as the length shrinks so this is always safe
+	capacity := (samples - len(headerData)*8) * int(h.Depth) / 8
+	if h.Matrix != 0 {
+		capacity = MatrixCapacity(samples-len(headerData)*8, int(h.Matrix)) / 8
+	}
+	if capacity < 0 {
+		return 0
+	}
+	if h.Parity != 0 {
+		return ECCCapacity(capacity, h.Parity)
+	}
+
+	return capacity
+}
+
+// ReadHeader reads a header, starting with the magic number, from r. The legacy v0
+// layout, versioned headers and robust versioned headers are all supported
+func ReadHeader(r io.ByteReader) (Header, error) {
+	magic, err := readUint16(r)
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to read magic number: %w", err)
+	}
+
+	switch magic {
+	case LegacyMagicNumber:
+		length, err := readUint16(r)
+		if err != nil {
+			return Header{}, fmt.Errorf("failed to read data length: %w", err)
+		}
+		return Header{Length: uint64(length), Depth: 1, Channels: RGBA}, nil
+	case MagicNumber:
+		header, err := readVersionedHeader(r)
+		if err != nil {
+			return Header{}, err
+		}
+		if header.Parity != 0 {
+			return Header{}, errors.New("header with parity is not robust")
+		}
+		return header, nil
+	}
+
+	// the magic number of a robust header may have been damaged, so read the whole
+	// first chunk and check the magic number once the copies have been compared
+	robust := &majorityReader{r: r, pending: []byte{byte(magic >> 8), byte(magic)}}
+	magic, err = readUint16(robust)
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to read magic number: %w", err)
+	}
+	if magic != RobustMagicNumber {
+		return Header{}, ErrNoPayload
+	}
+
+	header, err := readVersionedHeader(robust)
+	if err != nil {
+		return Header{}, err
+	}
+	if header.Parity == 0 {
+		return Header{}, errors.New("robust header is missing its parity")
+	}
+	return header, nil
+}
+
+// readVersionedHeader reads the rest of a versioned header that follows the magic
+// number
+func readVersionedHeader(r io.ByteReader) (Header, error) {
+	version, err := r.ReadByte()
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to read header version: %w", err)
+	}
+	if version != Version {
+		return Header{}, fmt.Errorf("unsupported header version %d", version)
+	}
+
+	flags, err := r.ReadByte()
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to read header flags: %w", err)
+	}
+
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to read data length: %w", err)
+	}
+
+	header := Header{
+		Version:  version,
+		Flags:    flags,
+		Length:   length,
+		Depth:    1,
+		Channels: RGB,
+	}
+	hasChecksum := false
+	for {
+		tag, value, err := readField(r)
+		if err != nil {
+			return Header{}, fmt.Errorf("failed to read header field: %w", err)
+		}
+
+		switch tag {
+		case fieldEnd:
+			if header.Flags&FlagEncrypted != 0 && (header.Salt == nil && header.Ephemeral == nil || header.Nonce == nil) {
+				return Header{}, errors.New("encrypted data is missing its salt or nonce")
+			}
+			if header.Ephemeral != nil && header.Recipients == nil {
+				return Header{}, errors.New("encrypted data has no recipients")
+			}
+			if header.Flags&FlagChecksum != 0 && !hasChecksum {
+				return Header{}, errors.New("header is missing its checksum")
+			}
+			if header.Matrix != 0 && header.Depth != 1 {
+				return Header{}, fmt.Errorf("matrix embedding can not be used at depth %d", header.Depth)
+			}
+			return header, nil
+		case fieldDepth:
+			if len(value) != 1 || value[0] < 1 || value[0] > MaxDepth {
+				return Header{}, fmt.Errorf("invalid depth %v", value)
+			}
+			header.Depth = value[0]
+		case fieldChannels:
+			if len(value) != 1 || value[0] == 0 || Channels(value[0]) > RGBA {
+				return Header{}, fmt.Errorf("invalid channels %v", value)
+			}
+			header.Channels = Channels(value[0])
+		case fieldSalt:
+			header.Salt = value
+		case fieldNonce:
+			header.Nonce = value
+		case fieldEphemeral:
+			header.Ephemeral = value
+		case fieldRecipient:
+			header.Recipients = append(header.Recipients, value)
+		case fieldChecksum:
+			if len(value) != 4 {
+				return Header{}, fmt.Errorf("invalid checksum %v", value)
+			}
+			header.Checksum = binary.BigEndian.Uint32(value)
+			hasChecksum = true
+		case fieldShard:
+			header.Shard, err = unmarshalShard(value)
+			if err != nil {
+				return Header{}, err
+			}
+		case fieldParity:
+			if len(value) != 1 || value[0] == 0 || int(value[0]) >= bits.MaxCodeword {
+				return Header{}, fmt.Errorf("invalid parity %v", value)
+			}
+			header.Parity = value[0]
+		case fieldTexture:
+			if len(value) != 1 || value[0] == 0 {
+				return Header{}, fmt.Errorf("invalid texture %v", value)
+			}
+			header.Texture = value[0]
+		case fieldMatrix:
+			if len(value) != 1 || value[0] < 2 || value[0] > MaxMatrix {
+				return Header{}, fmt.Errorf("invalid matrix embedding %v", value)
+			}
+			header.Matrix = value[0]
+		default:
+			return Header{}, fmt.Errorf("unknown header field %d", tag)
+		}
+	}
+}
+
+// appendField appends a tagged field to buf
+func appendField(buf []byte, tag uint8, value []byte) []byte {
+	buf = append(buf, tag)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// readField reads a tagged field from r, the end of the field list has no value
+func readField(r io.ByteReader) (uint8, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	if tag == fieldEnd {
+		return tag, nil, nil
+	}
+
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	// fields are small, anything bigger than this means the header is garbage
+	if size > 1024 {
+		return 0, nil, fmt.Errorf("field %d is too large", tag)
+	}
+
+	value := make([]byte, size)
+	for i := range value {
+		value[i], err = r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return tag, value, nil
+}
+
+// repeatHeader pads an encoded header to a multiple of headerChunk bytes and then
+// repeats each chunk headerRepeat times
+func repeatHeader(header []byte) []byte {
+	for len(header)%headerChunk != 0 {
+		header = append(header, 0)
+	}
+
+	var buf []byte
+	for i := 0; i < len(header); i += headerChunk {
+		buf = append(buf, bits.Repeat(header[i:i+headerChunk], headerRepeat)...)
+	}
+
+	return buf
+}
+
+// majorityReader reads a header written by repeatHeader, a bit is set if most of
+// its copies are set
+type majorityReader struct {
+	r io.ByteReader
+	// pending holds the repeated bytes read so far, before the first chunk is read
+	// it may hold bytes that were already read from r
+	pending []byte
+	chunk   []byte
+}
+
+// ReadByte reads the next byte of the header, reading and decoding a whole chunk
+// whenever the last one runs out
+func (m *majorityReader) ReadByte() (byte, error) {
+	if len(m.chunk) == 0 {
+		for len(m.pending) < headerChunk*headerRepeat {
+			b, err := m.r.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			m.pending = append(m.pending, b)
+		}
+
+		chunk, err := bits.Majority(m.pending, headerRepeat)
+		if err != nil {
+			return 0, err
+		}
+		m.chunk = chunk
+		m.pending = m.pending[:0]
+	}
+
+	b := m.chunk[0]
+	m.chunk = m.chunk[1:]
+	return b, nil
+}
+
+// readUint16 reads a big endian uint16 from r
+func readUint16(r io.ByteReader) (uint16, error) {
+	hi, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	lo, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(hi)<<8 | uint16(lo), nil
+}
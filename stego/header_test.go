@@ -0,0 +1,282 @@
+package stego
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header Header
+	}{
+		{
+			name: "empty",
+			header: Header{
+				Version:  Version,
+				Depth:    1,
+				Channels: RGB,
+			},
+		},
+		{
+			name: "larger than a uint16",
+			header: Header{
+				Version:  Version,
+				Length:   0x1_0000_0000,
+				Depth:    1,
+				Channels: RGB,
+			},
+		},
+		{
+			name: "with depth",
+			header: Header{
+				Version:  Version,
+				Length:   12,
+				Depth:    3,
+				Channels: Alpha,
+				Flags:    FlagTransparent,
+			},
+		},
+		{
+			name: "encrypted",
+			header: Header{
+				Version:  Version,
+				Flags:    FlagEncrypted,
+				Length:   40,
+				Depth:    1,
+				Channels: RGB,
+				Salt:     []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				Nonce:    []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+			},
+		},
+		{
+			name: "encrypted for recipients",
+			header: Header{
+				Version:    Version,
+				Flags:      FlagEncrypted,
+				Length:     40,
+				Depth:      1,
+				Channels:   RGB,
+				Nonce:      []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+				Ephemeral:  []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				Recipients: [][]byte{{1, 2, 3}, {4, 5, 6}},
+			},
+		},
+		{
+			name: "with checksum",
+			header: Header{
+				Version:  Version,
+				Flags:    FlagChecksum,
+				Length:   40,
+				Depth:    1,
+				Channels: RGB,
+				Checksum: 0xDEADBEEF,
+			},
+		},
+		{
+			name: "shard",
+			header: Header{
+				Version:  Version,
+				Length:   40,
+				Depth:    1,
+				Channels: RGB,
+				Shard:    Shard{Set: 0x0123456789ABCDEF, Index: 2, Total: 300},
+			},
+		},
+		{
+			name: "erasure coded shard",
+			header: Header{
+				Version:  Version,
+				Length:   40,
+				Depth:    1,
+				Channels: RGB,
+				Shard:    Shard{Set: 0x0123456789ABCDEF, Index: 4, Total: 5, Need: 3, Size: 100},
+			},
+		},
+		{
+			name: "error correction",
+			header: Header{
+				Version:  Version,
+				Flags:    FlagChecksum,
+				Length:   1020,
+				Depth:    2,
+				Channels: RGB,
+				Checksum: 0xDEADBEEF,
+				Parity:   32,
+			},
+		},
+		{
+			name: "matrix embedding",
+			header: Header{
+				Version:  Version,
+				Length:   300,
+				Depth:    1,
+				Channels: RGBA,
+				Matrix:   3,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.header.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary() unexpected error %v", err)
+			}
+
+			got, err := ReadHeader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("ReadHeader() unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.header) {
+				t.Errorf("ReadHeader() = %+v, want %+v", got, tt.header)
+			}
+		})
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	type args struct {
+		data []byte
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    Header
+		wantErr bool
+	}{
+		{
+			name: "legacy header",
+			args: args{
+				data: []byte{0x13, 0x37, 0x01, 0x02},
+			},
+			want:    Header{Version: 0, Length: 0x0102, Depth: 1, Channels: RGBA},
+			wantErr: false,
+		},
+		{
+			name: "versioned header",
+			args: args{
+				data: []byte{0xB1, 0x75, 0x01, 0x00, 0x80, 0x80, 0x04, 0x00},
+			},
+			want:    Header{Version: 1, Length: 0x1_0000, Depth: 1, Channels: RGB},
+			wantErr: false,
+		},
+		{
+			name: "depth field",
+			args: args{
+				data: []byte{0xB1, 0x75, 0x01, 0x00, 0x05, 0x01, 0x01, 0x04, 0x00},
+			},
+			want:    Header{Version: 1, Length: 5, Depth: 4, Channels: RGB},
+			wantErr: false,
+		},
+		{
+			name: "invalid depth",
+			args: args{
+				data: []byte{0xB1, 0x75, 0x01, 0x00, 0x05, 0x01, 0x01, 0x05, 0x00},
+			},
+			want:    Header{},
+			wantErr: true,
+		},
+		{
+			name: "channels field",
+			args: args{
+				data: []byte{0xB1, 0x75, 0x01, 0x01, 0x05, 0x02, 0x01, 0x08, 0x00},
+			},
+			want:    Header{Version: 1, Flags: FlagTransparent, Length: 5, Depth: 1, Channels: Alpha},
+			wantErr: false,
+		},
+		{
+			name: "matrix embedding above depth 1",
+			args: args{
+				data: []byte{0xB1, 0x75, 0x01, 0x00, 0x05, 0x01, 0x01, 0x02, 0x09, 0x01, 0x03, 0x00},
+			},
+			want:    Header{},
+			wantErr: true,
+		},
+		{
+			name: "encrypted without a nonce",
+			args: args{
+				data: []byte{0xB1, 0x75, 0x01, 0x02, 0x05, 0x03, 0x01, 0xFF, 0x00},
+			},
+			want:    Header{},
+			wantErr: true,
+		},
+		{
+			name: "bad magic number",
+			args: args{
+				data: []byte{0x13, 0x38, 0x01, 0x02},
+			},
+			want:    Header{},
+			wantErr: true,
+		},
+		{
+			name: "unknown version",
+			args: args{
+				data: []byte{0xB1, 0x75, 0x09, 0x00, 0x01, 0x00},
+			},
+			want:    Header{},
+			wantErr: true,
+		},
+		{
+			name: "truncated",
+			args: args{
+				data: []byte{0xB1, 0x75, 0x01},
+			},
+			want:    Header{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadHeader(bytes.NewReader(tt.args.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadHeader() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadHeader() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadHeaderRobust(t *testing.T) {
+	header := Header{Version: Version, Length: 300, Depth: 1, Channels: RGB, Parity: 16}
+	data, err := header.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() unexpected error %v", err)
+	}
+
+	// flip one copy of a few bits, including bits of the magic number
+	for _, bit := range []int{0, 10, 17, 40, 100, len(data)*8 - 1} {
+		data[bit/8] ^= 0x80 >> (bit % 8)
+	}
+
+	got, err := ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadHeader() unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(got, header) {
+		t.Errorf("ReadHeader() = %+v, want %+v", got, header)
+	}
+}
+
+func TestHeaderVerify(t *testing.T) {
+	data := []byte("Here's the hidden data")
+
+	var header Header
+	if err := header.Verify(data); err != nil {
+		t.Errorf("Verify() without a checksum unexpected error %v", err)
+	}
+
+	header.SetChecksum(data)
+	if err := header.Verify(data); err != nil {
+		t.Errorf("Verify() unexpected error %v", err)
+	}
+
+	data[0] ^= 0x01
+	if err := header.Verify(data); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrCorrupted)
+	}
+}
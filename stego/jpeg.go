@@ -0,0 +1,86 @@
+package stego
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+
+	"github.com/bjatkin/imgdemo/dct"
+)
+
+// JPEG is a baseline jpeg image. Compressing pixels as a jpeg destroys anything
+// hidden in them, so data is hidden in the quantized DCT coefficients instead, like
+// JSteg. Only AC coefficients with a magnitude of 2 or more are used, so changing the
+// lowest bit of a coefficient never turns it into 0 and never changes the huffman
+// symbol it's compressed with. DC coefficients are never used since they are stored as
+// the difference from the previous block. It implements image.Image with the pixels
+// decoded when it was read, which do not change as data is hidden
+type JPEG struct {
+	image.Image
+	Coefficients *dct.Image
+}
+
+// DecodeJPEG decodes both the pixels and the DCT coefficients of a baseline jpeg. It
+// returns dct.ErrUnsupported for progressive jpegs
+func DecodeJPEG(r io.Reader) (*JPEG, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	coefficients, err := dct.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &JPEG{Image: img, Coefficients: coefficients}, nil
+}
+
+// jpegSamples returns a sample for every AC coefficient of every block of every
+// component. Usable coefficients have a sample of 2 or 3 with the same lowest bit as
+// the coefficient's magnitude, every other coefficient has a sample of 0
+func jpegSamples(img *JPEG) []uint8 {
+	var pix []uint8
+	for _, c := range img.Coefficients.Components {
+		for _, block := range c.Blocks {
+			for _, coefficient := range block[1:] {
+				magnitude := abs(int(coefficient))
+				if magnitude < 2 {
+					pix = append(pix, 0)
+					continue
+				}
+				pix = append(pix, 2|uint8(magnitude&1))
+			}
+		}
+	}
+
+	return pix
+}
+
+// setJPEGSamples writes samples returned by jpegSamples back to the coefficients,
+// setting the lowest bit of each changed coefficient's magnitude and keeping its sign
+func setJPEGSamples(img *JPEG, pix []uint8) {
+	for _, c := range img.Coefficients.Components {
+		for b := range c.Blocks {
+			block := &c.Blocks[b]
+			for k := 1; k < 64; k++ {
+				sample := pix[0]
+				pix = pix[1:]
+				if sample < 2 {
+					continue
+				}
+
+				magnitude := int32(abs(int(block[k])))&^1 | int32(sample&1)
+				if block[k] < 0 {
+					magnitude = -magnitude
+				}
+				block[k] = magnitude
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package stego
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestJPEG(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			src.Set(x, y, color.RGBA{uint8(x * y * 7), uint8(x * 13), uint8(y*29 + x), 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 95})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := DecodeJPEG(&buf)
+	if err != nil {
+		t.Fatalf("DecodeJPEG() unexpected error %v", err)
+	}
+	pix, format, err := Pixels(img)
+	if err != nil || format != FormatJPEG {
+		t.Fatalf("Pixels() = %d, %v, want %d", format, err, FormatJPEG)
+	}
+
+	layout := Layout{Format: FormatJPEG}
+	data := []byte("hello world")
+	w := NewWriter(pix, layout)
+	w.Write(data)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() unexpected error %v", err)
+	}
+	SetPixels(img, pix)
+
+	// the changed coefficients have to survive being written and read again
+	buf.Reset()
+	err = img.Coefficients.Encode(&buf)
+	if err != nil {
+		t.Fatalf("Encode() unexpected error %v", err)
+	}
+	img, err = DecodeJPEG(&buf)
+	if err != nil {
+		t.Fatalf("DecodeJPEG() unexpected error %v", err)
+	}
+	pix, _, _ = Pixels(img)
+	for i, sample := range pix {
+		if sample == 1 || sample > 3 {
+			t.Fatalf("Pixels() sample %d = %d, want 0, 2 or 3", i, sample)
+		}
+	}
+
+	got := make([]byte, len(data))
+	_, err = NewReader(pix, layout).Read(got)
+	if err != nil {
+		t.Fatalf("Read() unexpected error %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Read() = %q, want %q", got, data)
+	}
+}
@@ -0,0 +1,239 @@
+package stego
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Channels is a set of NRGBA color channels that data can be hidden in
+type Channels uint8
+
+const (
+	Red Channels = 1 << iota
+	Green
+	Blue
+	Alpha
+
+	// RGB is the default set of channels, it leaves the alpha channel untouched
+	RGB = Red | Green | Blue
+	// RGBA is every channel in the image
+	RGBA = RGB | Alpha
+)
+
+// channelNames maps each channel to the letter used for it on the command line
+var channelNames = []struct {
+	channel Channels
+	name    string
+}{
+	{Red, "r"},
+	{Green, "g"},
+	{Blue, "b"},
+	{Alpha, "a"},
+}
+
+// ParseChannels parses a set of channels made up of the letters r, g, b and a, for
+// example "rgb" or "a"
+func ParseChannels(s string) (Channels, error) {
+	var channels Channels
+outer:
+	for _, r := range strings.ToLower(s) {
+		for _, c := range channelNames {
+			if string(r) == c.name {
+				channels |= c.channel
+				continue outer
+			}
+		}
+		return 0, fmt.Errorf("unknown channel '%c'", r)
+	}
+
+	if channels == 0 {
+		return 0, fmt.Errorf("at least one channel is required")
+	}
+
+	return channels, nil
+}
+
+// String returns the channels using the same letters accepted by ParseChannels
+func (c Channels) String() string {
+	var s string
+	for _, channel := range channelNames {
+		if c&channel.channel != 0 {
+			s += channel.name
+		}
+	}
+
+	return s
+}
+
+// Layout picks which samples of an image's pixel data are used to hide data, and the
+// order they are used in
+type Layout struct {
+	Channels Channels
+	// Transparent includes fully transparent pixels, which are skipped by default
+	// since changing them is easy to spot and breaks compositing
+	Transparent bool
+	// Key scatters the data over the whole image in a pseudorandom order seeded by
+	// the key. When it's empty samples are used in order
+	Key string
+	// Texture is the lowest texture score a pixel needs for its samples to be used,
+	// so data is only hidden in busy parts of the image where changes are hard to
+	// detect. When it's 0 every pixel is used
+	Texture uint8
+	// Format is the way samples are stored in the pixel data. Gray, paletted and jpeg
+	// images have no channels to pick from or transparent pixels to skip, so Channels and
+	// Transparent are ignored for them
+	Format Format
+	// Stride is the number of bytes between rows of the pixel data, like the Stride of
+	// an image.NRGBA. Texture uses it to find the pixels above and below each pixel,
+	// when it's 0 the pixel data is treated as a single row
+	Stride int
+}
+
+// MaxTexture is the highest texture score a pixel can have, when each of its color
+// samples is as far as possible from those of all 4 of its neighbors
+const MaxTexture = 4 * 3 * (0xFF >> MaxDepth)
+
+// LegacyLayout is the layout used by v0 headers, every sample of every pixel
+var LegacyLayout = Layout{Channels: RGBA, Transparent: true}
+
+// Count returns the number of samples in pix that can be used to hide data
+func (l Layout) Count(pix []uint8) int {
+	count := 0
+	for i := range pix {
+		if l.usable(pix, i) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// usable reports whether the sample at index i of pix can be used to hide data
+func (l Layout) usable(pix []uint8, i int) bool {
+	// only the last, least significant, byte of each sample is used
+	size := l.Format.size()
+	if i%size != size-1 {
+		return false
+	}
+
+	samples := l.Format.samples()
+	if samples == 4 && l.Channels&(1<<(i/size%4)) == 0 {
+		return false
+	}
+	if l.Format == FormatPaletted && pix[i] >= unpaired-1 {
+		return false
+	}
+	if l.Format == FormatJPEG && pix[i] < 2 {
+		return false
+	}
+	if l.Texture != 0 && texture(pix, i, l.Format, l.Stride) < l.Texture {
+		return false
+	}
+	if l.Transparent || samples == 1 {
+		return true
+	}
+
+	pixel := i - i%(4*size)
+	alpha := 0
+	for _, b := range pix[pixel+3*size : pixel+4*size] {
+		alpha = alpha<<8 | int(b)
+	}
+	if l.Channels&Alpha != 0 {
+		// hiding data in the alpha channel changes its low bits, so only the high bits
+		// can be used to decide if a pixel is transparent. Otherwise find would not be
+		// able to tell which pixels were skipped
+		return alpha>>MaxDepth != 0
+	}
+
+	return alpha != 0
+}
+
+// texture scores how busy the pixel holding sample i is, as the sum of the
+// differences between its color samples and those of the pixels to its left, right,
+// above and below. Neighbors outside the image are skipped, so edge pixels score
+// lower. Only the top 8-MaxDepth bits of each sample are compared since hiding data
+// never changes them, which lets find work out the same score from the changed image.
+// Gray and paletted pixels only have one sample so they score lower than color pixels
+func texture(pix []uint8, i int, format Format, stride int) uint8 {
+	size := format.size()
+	colors := min(format.samples(), 3)
+	width := format.samples() * size
+	p := i - i%width
+	if stride == 0 {
+		stride = len(pix)
+	}
+
+	// the pixels to the left and right must be on the same row
+	row := p - p%stride
+	neighbors := []int{p - stride, p + stride}
+	if p-width >= row {
+		neighbors = append(neighbors, p-width)
+	}
+	if p+width < row+stride {
+		neighbors = append(neighbors, p+width)
+	}
+
+	score := 0
+	for _, neighbor := range neighbors {
+		if neighbor < 0 || neighbor+width > len(pix) {
+			continue
+		}
+		// the first byte of a 16 bit sample holds its top bits
+		for c := 0; c < colors; c++ {
+			score += abs(int(pix[p+c*size]>>MaxDepth) - int(pix[neighbor+c*size]>>MaxDepth))
+		}
+	}
+
+	return uint8(score)
+}
+
+// cursor walks the usable samples of pix in the order picked by a layout
+type cursor struct {
+	pix    []uint8
+	layout Layout
+	order  *permutation
+	pos    int
+}
+
+// newCursor creates a cursor that starts at the first usable sample of pix
+func newCursor(pix []uint8, layout Layout) cursor {
+	c := cursor{pix: pix, layout: layout}
+	if layout.Key != "" {
+		c.order = newPermutation(layout.Key, len(pix))
+	}
+
+	return c
+}
+
+// remaining returns the number of usable samples the cursor has not reached yet
+func (c *cursor) remaining() int {
+	count := 0
+	for pos := c.pos; pos < len(c.pix); pos++ {
+		i := pos
+		if c.order != nil {
+			i = c.order.at(pos)
+		}
+		if c.layout.usable(c.pix, i) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// next returns the index of the next usable sample
+func (c *cursor) next() (int, bool) {
+	for c.pos < len(c.pix) {
+		i := c.pos
+		if c.order != nil {
+			i = c.order.at(c.pos)
+		}
+		c.pos++
+
+		if c.layout.usable(c.pix, i) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
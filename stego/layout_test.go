@@ -0,0 +1,233 @@
+package stego
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseChannels(t *testing.T) {
+	type args struct {
+		s string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    Channels
+		wantErr bool
+	}{
+		{
+			name:    "rgb",
+			args:    args{s: "rgb"},
+			want:    RGB,
+			wantErr: false,
+		},
+		{
+			name:    "alpha only",
+			args:    args{s: "A"},
+			want:    Alpha,
+			wantErr: false,
+		},
+		{
+			name:    "any order",
+			args:    args{s: "bar"},
+			want:    Red | Blue | Alpha,
+			wantErr: false,
+		},
+		{
+			name:    "unknown channel",
+			args:    args{s: "rgbx"},
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			args:    args{s: ""},
+			want:    0,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseChannels(tt.args.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseChannels() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseChannels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutCount(t *testing.T) {
+	pix := []uint8{
+		0x10, 0x20, 0x30, 0xFF,
+		0x10, 0x20, 0x30, 0x00,
+		0x10, 0x20, 0x30, 0x0F,
+	}
+	tests := []struct {
+		name   string
+		layout Layout
+		want   int
+	}{
+		{name: "rgb skips transparent pixels", layout: Layout{Channels: RGB}, want: 6},
+		{name: "rgb with transparent pixels", layout: Layout{Channels: RGB, Transparent: true}, want: 9},
+		{name: "alpha skips nearly transparent pixels", layout: Layout{Channels: Alpha}, want: 1},
+		{name: "legacy", layout: LegacyLayout, want: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.layout.Count(pix); got != tt.want {
+				t.Errorf("Count() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutTexture(t *testing.T) {
+	// a flat run of pixels followed by a busy one, the low bits differ everywhere
+	// but only the high bits count towards the texture score
+	pix := []uint8{
+		0x11, 0x12, 0x13, 0xFF,
+		0x1E, 0x1D, 0x1C, 0xFF,
+		0x10, 0x10, 0x10, 0xFF,
+		0x80, 0x40, 0x20, 0xFF,
+		0x10, 0x10, 0x10, 0xFF,
+	}
+	tests := []struct {
+		name    string
+		texture uint8
+		want    int
+	}{
+		{name: "every pixel", texture: 0, want: 15},
+		{name: "next to the busy pixel", texture: 1, want: 9},
+		{name: "only the busy pixel", texture: 20, want: 3},
+		{name: "too busy", texture: 255, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := Layout{Channels: RGB, Texture: tt.texture}
+			if got := layout.Count(pix); got != tt.want {
+				t.Errorf("Count() = %d, want %d", got, tt.want)
+			}
+
+			// changing the low bits must not change which samples are used
+			changed := bytes.Clone(pix)
+			for i := range changed {
+				changed[i] ^= 0x0F
+			}
+			if got := layout.Count(changed); got != tt.want {
+				t.Errorf("Count() after changing low bits = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutTextureStride(t *testing.T) {
+	flat := []uint8{0x10, 0x10, 0x10, 0xFF}
+	busy := []uint8{0x80, 0x80, 0x80, 0xFF}
+	dark := []uint8{0x00, 0x00, 0x00, 0xFF}
+	light := []uint8{0xFF, 0xFF, 0xFF, 0xFF}
+	tests := []struct {
+		name    string
+		pixels  [][]uint8
+		texture uint8
+		want    int
+	}{
+		{
+			name:    "pixels above and below count",
+			pixels:  [][]uint8{flat, flat, flat, flat, busy, flat, flat, flat, flat},
+			texture: 21,
+			want:    15,
+		},
+		{
+			name:    "only the busy pixel",
+			pixels:  [][]uint8{flat, flat, flat, flat, busy, flat, flat, flat, flat},
+			texture: 22,
+			want:    3,
+		},
+		{
+			// edge pixels have fewer neighbors, and the last pixel of a row is not
+			// next to the first pixel of the next one
+			name:    "highest score",
+			pixels:  [][]uint8{dark, light, dark, light, dark, light, dark, light, dark},
+			texture: MaxTexture,
+			want:    3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pix []uint8
+			for _, pixel := range tt.pixels {
+				pix = append(pix, pixel...)
+			}
+
+			layout := Layout{Channels: RGB, Texture: tt.texture, Stride: 3 * 4}
+			if got := layout.Count(pix); got != tt.want {
+				t.Errorf("Count() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayoutFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout Layout
+		pix    []uint8
+		want   int
+	}{
+		{
+			name:   "nrgba64 skips transparent pixels",
+			layout: Layout{Channels: RGB, Format: FormatNRGBA64},
+			pix: []uint8{
+				0x10, 0x11, 0x20, 0x21, 0x30, 0x31, 0xFF, 0xFF,
+				0x10, 0x11, 0x20, 0x21, 0x30, 0x31, 0x00, 0x00,
+				0x10, 0x11, 0x20, 0x21, 0x30, 0x31, 0x01, 0x00,
+			},
+			want: 6,
+		},
+		{
+			name:   "nrgba64 alpha uses every bit of the sample",
+			layout: Layout{Channels: Alpha, Format: FormatNRGBA64},
+			pix: []uint8{
+				0x10, 0x11, 0x20, 0x21, 0x30, 0x31, 0x00, 0x0F,
+				0x10, 0x11, 0x20, 0x21, 0x30, 0x31, 0x00, 0x10,
+			},
+			want: 1,
+		},
+		{
+			name:   "gray ignores channels",
+			layout: Layout{Channels: Alpha, Format: FormatGray},
+			pix:    []uint8{0x00, 0x10, 0x20, 0x30, 0x40},
+			want:   5,
+		},
+		{
+			name:   "gray16",
+			layout: Layout{Channels: RGB, Format: FormatGray16},
+			pix:    []uint8{0x00, 0x10, 0x20, 0x30, 0x40, 0x50},
+			want:   3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.layout.Count(tt.pix); got != tt.want {
+				t.Errorf("Count() = %d, want %d", got, tt.want)
+			}
+
+			// writing only ever changes the low byte of each sample
+			pix := bytes.Clone(tt.pix)
+			w := NewWriter(pix, tt.layout)
+			w.Depth = MaxDepth
+			w.Write(bytes.Repeat([]byte{0xA5}, tt.want*MaxDepth/8))
+			w.Flush()
+			size := tt.layout.Format.size()
+			for i := range pix {
+				if i%size != size-1 && pix[i] != tt.pix[i] {
+					t.Errorf("Write() changed high byte %d from %#x to %#x", i, tt.pix[i], pix[i])
+				}
+			}
+		})
+	}
+}
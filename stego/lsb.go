@@ -0,0 +1,251 @@
+package stego
+
+import (
+	"io"
+	"math/rand/v2"
+
+	"github.com/bjatkin/imgdemo/bits"
+)
+
+const (
+	// MaxDepth is the largest number of low bits that can be used in each sample
+	MaxDepth = 4
+	// MaxMatrix is the largest number of bits that can be hidden in each group of
+	// samples with matrix embedding
+	MaxMatrix = 7
+)
+
+// Writer hides data in the lowest Depth bits of each sample picked by a layout
+type Writer struct {
+	Depth int
+	// Matching changes each sample by the smallest amount that gives it the right low
+	// bits, randomly adding or subtracting, instead of replacing its low bits. Plain
+	// replacement leaves pairs of values with the same count which is easy to detect.
+	// The change can reach the high bits so it must not be used where they matter
+	Matching bool
+	// Matrix hides this many bits in each group of 2^Matrix-1 samples using
+	// matrix embedding, see matrix.go. It's only used with a Depth of 1, when it's 0
+	// every sample holds Depth bits of its own
+	Matrix int
+
+	pix     []uint8
+	cursor  cursor
+	pending []bool
+}
+
+// NewWriter creates a writer that hides data in the lowest bit of each sample of pix
+// that the layout allows
+func NewWriter(pix []uint8, layout Layout) *Writer {
+	return &Writer{Depth: 1, pix: pix, cursor: newCursor(pix, layout)}
+}
+
+// Write hides p in the samples, any bits that do not fill a whole sample are held
+// until the next call to Write or Flush
+func (w *Writer) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, bits.FromBytes(p)...)
+	if w.Matrix != 0 {
+		for len(w.pending) >= w.Matrix {
+			err := w.writeMatrix(w.pending[:w.Matrix])
+			if err != nil {
+				return 0, err
+			}
+			w.pending = w.pending[w.Matrix:]
+		}
+		return len(p), nil
+	}
+
+	for len(w.pending) >= w.Depth {
+		i, ok := w.cursor.next()
+		if !ok {
+			return 0, io.ErrShortWrite
+		}
+		w.set(i, setLow(w.pix[i], w.pending[:w.Depth]))
+		w.pending = w.pending[w.Depth:]
+	}
+
+	return len(p), nil
+}
+
+// Flush writes any held bits into the high end of the next sample's low bits.
+// It must be called before changing Depth and after the last Write
+func (w *Writer) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	if w.Matrix != 0 {
+		// the reader ignores the padding since it only reads whole bytes
+		pending := append(w.pending, make([]bool, w.Matrix-len(w.pending))...)
+		w.pending = nil
+		return w.writeMatrix(pending)
+	}
+
+	i, ok := w.cursor.next()
+	if !ok {
+		return io.ErrShortWrite
+	}
+
+	sample := w.pix[i]
+	keep := w.Depth - len(w.pending)
+	w.set(i, setLow(sample>>keep, w.pending)<<keep|sample&(1<<keep-1))
+	w.pending = nil
+	return nil
+}
+
+// SetTexture changes the lowest texture score of the pixels used from here on. It
+// must be called after Flush, like changing Depth and Matrix
+func (w *Writer) SetTexture(texture uint8) {
+	w.cursor.layout.Texture = texture
+}
+
+// set changes the sample at index i so its low bits match those of target
+func (w *Writer) set(i int, target uint8) {
+	if !w.Matching {
+		w.pix[i] = target
+		return
+	}
+
+	// the low byte of a 16 bit sample is matched along with its high byte, so a change
+	// can carry into it rather than being clamped to the low byte's range
+	if w.cursor.layout.Format.size() == 2 {
+		sample := int(w.pix[i-1])<<8 | int(w.pix[i])
+		value := matchLow(sample, sample&^0xFF|int(target), w.Depth, 0xFFFF)
+		w.pix[i-1], w.pix[i] = uint8(value>>8), uint8(value)
+		return
+	}
+
+	w.pix[i] = uint8(matchLow(int(w.pix[i]), int(target), w.Depth, 0xFF))
+}
+
+// Reader reads data hidden by a Writer from the lowest Depth bits of each sample
+// picked by a layout
+type Reader struct {
+	Depth int
+	// Matrix reads data hidden with matrix embedding, see Writer
+	Matrix int
+
+	pix     []uint8
+	cursor  cursor
+	pending []bool
+}
+
+// NewReader creates a reader that reads data from the lowest bit of each sample of
+// pix that the layout allows
+func NewReader(pix []uint8, layout Layout) *Reader {
+	return &Reader{Depth: 1, pix: pix, cursor: newCursor(pix, layout)}
+}
+
+// ReadByte reads the next 8 hidden bits
+func (r *Reader) ReadByte() (byte, error) {
+	for len(r.pending) < 8 {
+		if r.Matrix != 0 {
+			group, err := r.readMatrix()
+			if err != nil {
+				return 0, err
+			}
+			r.pending = append(r.pending, group...)
+			continue
+		}
+
+		i, ok := r.cursor.next()
+		if !ok {
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.pending = append(r.pending, getLow(r.pix[i], r.Depth)...)
+	}
+
+	data, err := bits.ToBytes(r.pending[:8])
+	if err != nil {
+		return 0, err
+	}
+	r.pending = r.pending[8:]
+
+	return data[0], nil
+}
+
+// Read fills p with hidden data
+func (r *Reader) Read(p []byte) (int, error) {
+	for i := range p {
+		b, err := r.ReadByte()
+		if err != nil {
+			return i, err
+		}
+		p[i] = b
+	}
+
+	return len(p), nil
+}
+
+// Discard drops any bits left over from a partially read sample. It must be
+// called before changing Depth
+func (r *Reader) Discard() {
+	r.pending = nil
+}
+
+// SetTexture changes the lowest texture score of the pixels used from here on. It
+// must be called after Discard, like changing Depth and Matrix
+func (r *Reader) SetTexture(texture uint8) {
+	r.cursor.layout.Texture = texture
+}
+
+// Remaining returns the number of bits left in the samples after the ones already
+// read, using the current depth, matrix and texture
+func (r *Reader) Remaining() int {
+	count := r.cursor.remaining()
+	if r.Matrix != 0 {
+		return count/matrixSamples(r.Matrix)*r.Matrix + len(r.pending)
+	}
+	return count*r.Depth + len(r.pending)
+}
+
+// setLow replaces the lowest len(b) bits of sample with b
+func setLow(sample uint8, b []bool) uint8 {
+	for i, set := range b {
+		bit := uint8(1) << (len(b) - 1 - i)
+		if set {
+			sample |= bit
+		} else {
+			sample &^= bit
+		}
+	}
+
+	return sample
+}
+
+// matchLow returns the value, between 0 and limit, closest to sample that has the same
+// lowest depth bits as target. When adding and subtracting are just as close one is
+// picked at random
+func matchLow(sample, target, depth, limit int) int {
+	step := 1 << depth
+	best := target
+	for _, candidate := range []int{target - step, target + step} {
+		if candidate < 0 || candidate > limit {
+			continue
+		}
+
+		distance, bestDistance := abs(candidate-sample), abs(best-sample)
+		if distance < bestDistance || (distance == bestDistance && rand.IntN(2) == 0) {
+			best = candidate
+		}
+	}
+
+	return best
+}
+
+// abs returns the absolute value of x
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// getLow returns the lowest depth bits of sample
+func getLow(sample uint8, depth int) []bool {
+	b := make([]bool, 0, depth)
+	for i := depth - 1; i >= 0; i-- {
+		b = append(b, sample&(1<<i) > 0)
+	}
+
+	return b
+}
@@ -0,0 +1,210 @@
+package stego
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestWriterReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int
+		data  []byte
+	}{
+		{name: "depth 1", depth: 1, data: []byte("hello world")},
+		{name: "depth 2", depth: 2, data: []byte("hello world")},
+		{name: "depth 3", depth: 3, data: []byte("hello world")},
+		{name: "depth 4", depth: 4, data: []byte("hello world")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := bytes.Repeat([]byte{0xAA}, 8+len(tt.data)*8/tt.depth+1)
+
+			w := NewWriter(samples, LegacyLayout)
+			w.Write([]byte{0x5A})
+			w.Depth = tt.depth
+			w.Write(tt.data)
+			if err := w.Flush(); err != nil {
+				t.Fatalf("Flush() unexpected error %v", err)
+			}
+
+			for i, s := range samples {
+				if s&0xF0 != 0xA0 {
+					t.Fatalf("Write() changed high bits of sample %d: %08b", i, s)
+				}
+			}
+
+			r := NewReader(samples, LegacyLayout)
+			first, err := r.ReadByte()
+			if err != nil || first != 0x5A {
+				t.Fatalf("ReadByte() = %x, %v, want 5a", first, err)
+			}
+			r.Depth = tt.depth
+			got := make([]byte, len(tt.data))
+			if _, err := r.Read(got); err != nil {
+				t.Fatalf("Read() unexpected error %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("Read() = %q, want %q", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestWriterShortWrite(t *testing.T) {
+	w := NewWriter(make([]byte, 7), LegacyLayout)
+	if _, err := w.Write([]byte{0xFF}); err == nil {
+		t.Errorf("Write() expected an error when the samples run out")
+	}
+}
+
+func TestWriterMatching(t *testing.T) {
+	tests := []struct {
+		name    string
+		depth   int
+		samples []byte
+	}{
+		{name: "depth 1", depth: 1, samples: bytes.Repeat([]byte{0x00, 0x7F, 0x80, 0xFF}, 32)},
+		{name: "depth 2", depth: 2, samples: bytes.Repeat([]byte{0x40, 0x7E, 0x81, 0xC3}, 32)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("hello world!")
+			original := bytes.Clone(tt.samples)
+
+			w := NewWriter(tt.samples, LegacyLayout)
+			w.Depth = tt.depth
+			w.Matching = true
+			w.Write(data)
+			if err := w.Flush(); err != nil {
+				t.Fatalf("Flush() unexpected error %v", err)
+			}
+
+			limit := 1 << (tt.depth - 1)
+			for i, s := range tt.samples {
+				if abs(int(s)-int(original[i])) > limit {
+					t.Fatalf("Write() changed sample %d from %d to %d", i, original[i], s)
+				}
+			}
+
+			r := NewReader(tt.samples, LegacyLayout)
+			r.Depth = tt.depth
+			got := make([]byte, len(data))
+			if _, err := r.Read(got); err != nil {
+				t.Fatalf("Read() unexpected error %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Read() = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestWriterMatching16(t *testing.T) {
+	// 16 bit samples whose low byte is at the edge of its range, so matching has to
+	// carry into the high byte to stay within 2 of the original
+	samples := bytes.Repeat([]byte{0x12, 0xFF, 0x13, 0x00, 0x80, 0xFE, 0x7F, 0x01}, 32)
+	original := bytes.Clone(samples)
+	layout := Layout{Channels: RGB, Format: FormatGray16}
+	data := []byte("hello world!")
+
+	w := NewWriter(samples, layout)
+	w.Depth = 2
+	w.Matching = true
+	w.Write(data)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() unexpected error %v", err)
+	}
+
+	for i := 0; i < len(samples); i += 2 {
+		got := int(samples[i])<<8 | int(samples[i+1])
+		want := int(original[i])<<8 | int(original[i+1])
+		if abs(got-want) > 2 {
+			t.Fatalf("Write() changed sample %d from %#04x to %#04x", i/2, want, got)
+		}
+	}
+
+	r := NewReader(samples, layout)
+	r.Depth = 2
+	got := make([]byte, len(data))
+	if _, err := r.Read(got); err != nil {
+		t.Fatalf("Read() unexpected error %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Read() = %q, want %q", got, data)
+	}
+}
+
+func TestWriterMatrix(t *testing.T) {
+	for k := 2; k <= MaxMatrix; k++ {
+		t.Run(fmt.Sprintf("%d bits", k), func(t *testing.T) {
+			data := []byte("hello world!")
+			n := matrixSamples(k)
+			groups := (len(data)*8 + k - 1) / k
+			samples := make([]byte, groups*n)
+			for i := range samples {
+				samples[i] = byte(i * 37)
+			}
+			original := bytes.Clone(samples)
+
+			w := NewWriter(samples, LegacyLayout)
+			w.Matrix = k
+			w.Write(data)
+			if err := w.Flush(); err != nil {
+				t.Fatalf("Flush() unexpected error %v", err)
+			}
+
+			for g := 0; g < groups; g++ {
+				changed := 0
+				for i := g * n; i < (g+1)*n; i++ {
+					if samples[i] != original[i] {
+						changed++
+					}
+					if samples[i]^original[i] > 1 {
+						t.Fatalf("Write() changed sample %d from %d to %d", i, original[i], samples[i])
+					}
+				}
+				if changed > 1 {
+					t.Fatalf("Write() changed %d samples in group %d, want at most 1", changed, g)
+				}
+			}
+
+			r := NewReader(samples, LegacyLayout)
+			r.Matrix = k
+			if got, want := r.Remaining(), groups*k; got != want {
+				t.Errorf("Remaining() = %d, want %d", got, want)
+			}
+			got := make([]byte, len(data))
+			if _, err := r.Read(got); err != nil {
+				t.Fatalf("Read() unexpected error %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Read() = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestReaderRemainingTexture(t *testing.T) {
+	// the first byte is read from flat pixels, only the pixels after the third one
+	// are next to a busy pixel
+	var pix []uint8
+	for i := 0; i < 12; i++ {
+		sample := uint8(0x10)
+		if i >= 4 && i%2 == 0 {
+			sample = 0x80
+		}
+		pix = append(pix, sample, sample, sample, 0xFF)
+	}
+
+	r := NewReader(pix, Layout{Channels: RGB})
+	if _, err := r.ReadByte(); err != nil {
+		t.Fatalf("ReadByte() unexpected error %v", err)
+	}
+	r.Discard()
+	r.SetTexture(1)
+	if got, want := r.Remaining(), 9*3; got != want {
+		t.Errorf("Remaining() = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package stego
+
+import "io"
+
+// Matrix embedding hides k bits in a group of 2^k-1 samples while changing at most
+// one of them. The data is the syndrome of the group's lowest bits under a Hamming
+// code: the xor of the 1-based positions of every sample whose lowest bit is set.
+// Any k bit value can be reached by flipping the lowest bit of the one sample whose
+// position is the xor of the current and wanted syndromes, or by changing nothing
+// if they already match. Plain LSB hiding changes half the samples it uses, this
+// changes one in 2^k, at the cost of using more samples for the same data
+
+// matrixSamples returns the number of samples in each group for k bits
+func matrixSamples(k int) int {
+	return 1<<k - 1
+}
+
+// MatrixCapacity returns the number of bits that fit in samples with matrix
+// embedding of k bits per group
+func MatrixCapacity(samples, k int) int {
+	return samples / matrixSamples(k) * k
+}
+
+// writeMatrix hides the bits of data, which must have length Matrix, in the next
+// group of samples
+func (w *Writer) writeMatrix(data []bool) error {
+	group := make([]int, matrixSamples(w.Matrix))
+	for j := range group {
+		i, ok := w.cursor.next()
+		if !ok {
+			return io.ErrShortWrite
+		}
+		group[j] = i
+	}
+
+	want := 0
+	for _, bit := range data {
+		want <<= 1
+		if bit {
+			want |= 1
+		}
+	}
+
+	flip := syndrome(w.pix, group) ^ want
+	if flip != 0 {
+		i := group[flip-1]
+		w.set(i, w.pix[i]^1)
+	}
+
+	return nil
+}
+
+// readMatrix reads Matrix bits from the next group of samples
+func (r *Reader) readMatrix() ([]bool, error) {
+	group := make([]int, matrixSamples(r.Matrix))
+	for j := range group {
+		i, ok := r.cursor.next()
+		if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		group[j] = i
+	}
+
+	s := syndrome(r.pix, group)
+	data := make([]bool, r.Matrix)
+	for j := range data {
+		data[j] = s&(1<<(r.Matrix-1-j)) != 0
+	}
+
+	return data, nil
+}
+
+// syndrome returns the xor of the 1-based positions in group of every sample whose
+// lowest bit is set
+func syndrome(pix []uint8, group []int) int {
+	s := 0
+	for j, i := range group {
+		if pix[i]&1 != 0 {
+			s ^= j + 1
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,80 @@
+package stego
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"slices"
+)
+
+// Data is hidden in paletted images the way EzStego does it. The palette is sorted by
+// luminance and each pixel's sample is the position of its color in the sorted
+// palette. Neighbouring colors in the sorted palette look alike, so changing the
+// lowest bit of a sample swaps its color for a similar one, and the palette itself is
+// never changed. Colors without a partner are given the sample 0xFF, that's the last
+// color of an odd sized palette, and any pair of colors with different alpha, since
+// swapping a transparent pixel for an opaque one would be easy to see. A sample only
+// has 8 bits, so the last two colors of a 256 color palette, at positions 0xFE and
+// 0xFF, can't be told apart from an unpaired color. That pair is never used, keeping
+// it unused also keeps data hidden in full palettes readable
+
+// unpaired is the sample given to pixels whose color has no partner to swap with
+const unpaired = 0xFF
+
+// sortPalette returns the indexes of palette sorted by luminance. Colors are sorted
+// by alpha first so opaque colors are never swapped with transparent ones, ties keep
+// their palette order so the result only depends on the palette
+func sortPalette(palette color.Palette) []int {
+	order := make([]int, len(palette))
+	keys := make([][2]uint32, len(palette))
+	for i, c := range palette {
+		order[i] = i
+		r, g, b, a := c.RGBA()
+		keys[i] = [2]uint32{a, 299*r + 587*g + 114*b}
+	}
+
+	slices.SortStableFunc(order, func(x, y int) int {
+		return cmp.Or(cmp.Compare(keys[x][0], keys[y][0]), cmp.Compare(keys[x][1], keys[y][1]))
+	})
+
+	return order
+}
+
+// paletteSamples returns the sample of every pixel of img
+func paletteSamples(img *image.Paletted) []uint8 {
+	order := sortPalette(img.Palette)
+	positions := make([]uint8, 256)
+	for i := range positions {
+		positions[i] = unpaired
+	}
+	for position, index := range order {
+		partner := position ^ 1
+		if partner >= len(order) {
+			continue
+		}
+
+		_, _, _, alpha := img.Palette[index].RGBA()
+		_, _, _, partnerAlpha := img.Palette[order[partner]].RGBA()
+		if alpha == partnerAlpha {
+			positions[index] = uint8(position)
+		}
+	}
+
+	pix := make([]uint8, len(img.Pix))
+	for i, index := range img.Pix {
+		pix[i] = positions[index]
+	}
+
+	return pix
+}
+
+// setPaletteSamples sets every pixel of img whose sample has changed to the color at
+// its new position in the sorted palette
+func setPaletteSamples(img *image.Paletted, pix []uint8) {
+	order := sortPalette(img.Palette)
+	for i, sample := range paletteSamples(img) {
+		if pix[i] != sample {
+			img.Pix[i] = uint8(order[pix[i]])
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package stego
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestSortPalette(t *testing.T) {
+	palette := color.Palette{
+		color.Gray{0xFF},
+		color.NRGBA{0x00, 0x00, 0x00, 0x00},
+		color.Gray{0x00},
+		color.Gray{0x80},
+		color.Gray{0x80},
+	}
+	// transparent colors come first, ties keep their palette order
+	want := []int{1, 2, 3, 4, 0}
+	if got := sortPalette(palette); !reflect.DeepEqual(got, want) {
+		t.Errorf("sortPalette() = %v, want %v", got, want)
+	}
+}
+
+func TestPaletteSamples(t *testing.T) {
+	var palette color.Palette
+	for i := 0; i < 256; i++ {
+		// in reverse luminance order so the sorted positions differ from the indexes
+		palette = append(palette, color.Gray{uint8(255 - i)})
+	}
+	tests := []struct {
+		name    string
+		palette color.Palette
+		pix     []uint8
+		want    []uint8
+		usable  int
+	}{
+		{
+			name:    "odd palette",
+			palette: palette[:5],
+			pix:     []uint8{0, 1, 2, 3, 4},
+			want:    []uint8{0xFF, 3, 2, 1, 0},
+			usable:  4,
+		},
+		{
+			name:    "transparent color",
+			palette: color.Palette{color.Black, color.NRGBA{}, color.White, color.Gray{0x80}, color.Gray{0x40}},
+			pix:     []uint8{0, 1, 2, 3, 4},
+			want:    []uint8{0xFF, 0xFF, 0xFF, 3, 2},
+			usable:  2,
+		},
+		{
+			name:    "full palette",
+			palette: palette,
+			pix:     []uint8{0, 1, 2, 255},
+			want:    []uint8{255, 254, 253, 0},
+			usable:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := &image.Paletted{Pix: bytes.Clone(tt.pix), Stride: len(tt.pix), Rect: image.Rect(0, 0, len(tt.pix), 1), Palette: tt.palette}
+			pix, format, err := Pixels(img)
+			if err != nil {
+				t.Fatalf("Pixels() unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(pix, tt.want) {
+				t.Errorf("Pixels() = %v, want %v", pix, tt.want)
+			}
+
+			layout := Layout{Channels: RGB, Format: format}
+			if got := layout.Count(pix); got != tt.usable {
+				t.Errorf("Count() = %d, want %d", got, tt.usable)
+			}
+
+			// flipping the lowest bit of every usable sample swaps each pixel to its
+			// partner color, which must read back as the flipped sample
+			for i := range pix {
+				if pix[i] < unpaired-1 {
+					pix[i] ^= 1
+				}
+			}
+			SetPixels(img, pix)
+
+			got, _, _ := Pixels(img)
+			if !reflect.DeepEqual(got, pix) {
+				t.Errorf("Pixels() after SetPixels() = %v, want %v", got, pix)
+			}
+		})
+	}
+}
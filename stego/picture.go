@@ -0,0 +1,65 @@
+package stego
+
+import (
+	"errors"
+	"image"
+)
+
+// MaxImageBits is the largest number of bits of each secret sample that HideImage can
+// hide, the cover keeps at least its top bit
+const MaxImageBits = 7
+
+// HideImage hides secret inside cover by replacing the lowest bits of each of the
+// cover's red, green and blue samples with the top bits of the matching secret sample.
+// More bits show more of the secret but change the cover more. The alpha channel is
+// left untouched, and both images have to be the same size
+func HideImage(cover, secret *image.NRGBA, bits int) error {
+	if bits < 1 || bits > MaxImageBits {
+		return errors.New("invalid number of bits")
+	}
+	if cover.Bounds().Size() != secret.Bounds().Size() {
+		return errors.New("the secret image must be the same size as the cover image")
+	}
+
+	low := uint8(1)<<bits - 1
+	size := cover.Bounds().Size()
+	for y := 0; y < size.Y; y++ {
+		c := cover.Pix[y*cover.Stride : y*cover.Stride+size.X*4]
+		s := secret.Pix[y*secret.Stride : y*secret.Stride+size.X*4]
+		for i := range c {
+			if i%4 == 3 {
+				continue
+			}
+			c[i] = c[i]&^low | s[i]>>(8-bits)
+		}
+	}
+
+	return nil
+}
+
+// RevealImage rebuilds the secret image hidden in img by HideImage. The lowest bits of
+// each sample become its top bits, and the bits that were lost are set to the middle
+// of their range so the secret is not darker than it was. The result is fully opaque
+func RevealImage(img *image.NRGBA, bits int) (*image.NRGBA, error) {
+	if bits < 1 || bits > MaxImageBits {
+		return nil, errors.New("invalid number of bits")
+	}
+
+	low := uint8(1)<<bits - 1
+	half := uint8(0x80) >> bits
+	size := img.Bounds().Size()
+	secret := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	for y := 0; y < size.Y; y++ {
+		src := img.Pix[y*img.Stride : y*img.Stride+size.X*4]
+		dst := secret.Pix[y*secret.Stride : y*secret.Stride+size.X*4]
+		for i := range src {
+			if i%4 == 3 {
+				dst[i] = 0xFF
+				continue
+			}
+			dst[i] = (src[i]&low)<<(8-bits) | half
+		}
+	}
+
+	return secret, nil
+}
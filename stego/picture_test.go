@@ -0,0 +1,69 @@
+package stego
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestHideImage(t *testing.T) {
+	cover := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	cover.SetNRGBA(0, 0, color.NRGBA{0xAB, 0xCD, 0xEF, 0x80})
+	cover.SetNRGBA(1, 0, color.NRGBA{0x12, 0x34, 0x56, 0xFF})
+	secret := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	secret.SetNRGBA(0, 0, color.NRGBA{0xF0, 0x10, 0x80, 0x00})
+	secret.SetNRGBA(1, 0, color.NRGBA{0x3C, 0xFF, 0x00, 0xFF})
+
+	tests := []struct {
+		name  string
+		bits  int
+		cover []color.NRGBA
+		want  []color.NRGBA
+	}{
+		{
+			name:  "4 bits",
+			bits:  4,
+			cover: []color.NRGBA{{0xAF, 0xC1, 0xE8, 0x80}, {0x13, 0x3F, 0x50, 0xFF}},
+			want:  []color.NRGBA{{0xF8, 0x18, 0x88, 0xFF}, {0x38, 0xF8, 0x08, 0xFF}},
+		},
+		{
+			name:  "1 bit",
+			bits:  1,
+			cover: []color.NRGBA{{0xAB, 0xCC, 0xEF, 0x80}, {0x12, 0x35, 0x56, 0xFF}},
+			want:  []color.NRGBA{{0xC0, 0x40, 0xC0, 0xFF}, {0x40, 0xC0, 0x40, 0xFF}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(cover.Bounds())
+			copy(img.Pix, cover.Pix)
+
+			err := HideImage(img, secret, tt.bits)
+			if err != nil {
+				t.Fatalf("HideImage() unexpected error %v", err)
+			}
+			for x, want := range tt.cover {
+				if got := img.NRGBAAt(x, 0); got != want {
+					t.Errorf("HideImage() pixel %d = %v, want %v", x, got, want)
+				}
+			}
+
+			revealed, err := RevealImage(img, tt.bits)
+			if err != nil {
+				t.Fatalf("RevealImage() unexpected error %v", err)
+			}
+			for x, want := range tt.want {
+				if got := revealed.NRGBAAt(x, 0); got != want {
+					t.Errorf("RevealImage() pixel %d = %v, want %v", x, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHideImageSize(t *testing.T) {
+	err := HideImage(image.NewNRGBA(image.Rect(0, 0, 2, 2)), image.NewNRGBA(image.Rect(0, 0, 2, 1)), 4)
+	if err == nil {
+		t.Errorf("HideImage() expected an error for images of different sizes")
+	}
+}
@@ -0,0 +1,200 @@
+package stego
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const (
+	// messageKeySize is the size of the random AES-256 key the data is encrypted with
+	messageKeySize = 32
+	// wrapInfo is mixed into the key used to wrap the message key for each recipient
+	wrapInfo = "imgdemo recipient"
+)
+
+// ErrKeyRequired is returned when trying to read data encrypted for recipients without
+// a private key
+var ErrKeyRequired = errors.New("the hidden data is encrypted for recipients, a private key is required")
+
+// ErrNotRecipient is returned when the private key is not one of the keys the data was
+// encrypted for
+var ErrNotRecipient = errors.New("the hidden data was not encrypted for this private key")
+
+// SealFor encrypts data with AES-GCM using a random message key. The message key is
+// wrapped for each recipient using a key agreed between a one time X25519 key and the
+// recipient's public key, so any of them can decrypt the data with OpenWith. Like
+// Seal, the header's flags are authenticated too
+func SealFor(header *Header, recipients []*ecdh.PublicKey, data []byte) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+
+	messageKey := make([]byte, messageKeySize)
+	_, err := rand.Read(messageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate message key: %w", err)
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	wrapped := make([][]byte, len(recipients))
+	for i, recipient := range recipients {
+		wrap, err := newWrapAEAD(ephemeral, recipient, ephemeral.PublicKey(), recipient)
+		if err != nil {
+			return nil, err
+		}
+
+		// every wrapping key is only ever used once so a zero nonce is safe
+		wrapped[i] = wrap.Seal(nil, make([]byte, wrap.NonceSize()), messageKey, nil)
+	}
+
+	aead, err := newGCM(messageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header.Flags |= FlagEncrypted
+	header.Salt = nil
+	header.Nonce = nonce
+	header.Ephemeral = ephemeral.PublicKey().Bytes()
+	header.Recipients = wrapped
+	return aead.Seal(nil, nonce, data, additionalData(*header)), nil
+}
+
+// OpenWith decrypts data that was encrypted by SealFor, using key to unwrap the message
+// key stored in the header
+func OpenWith(header Header, key *ecdh.PrivateKey, data []byte) ([]byte, error) {
+	if key == nil {
+		return nil, ErrKeyRequired
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(header.Ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+
+	wrap, err := newWrapAEAD(key, ephemeral, ephemeral, key.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	var messageKey []byte
+	for _, wrapped := range header.Recipients {
+		messageKey, err = wrap.Open(nil, make([]byte, wrap.NonceSize()), wrapped, nil)
+		if err == nil {
+			break
+		}
+	}
+	if messageKey == nil {
+		return nil, ErrNotRecipient
+	}
+
+	aead, err := newGCM(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(header.Nonce))
+	}
+
+	plain, err := aead.Open(nil, header.Nonce, data, additionalData(header))
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+
+	return plain, nil
+}
+
+// newWrapAEAD creates the AES-GCM cipher used to wrap the message key for recipient.
+// The shared secret is agreed between private and peer, one of which is the ephemeral
+// key, and both public keys are mixed in so the wrapping key is tied to this pair
+func newWrapAEAD(private *ecdh.PrivateKey, peer, ephemeral, recipient *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := private.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on a key: %w", err)
+	}
+
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+	key, err := hkdf.Key(sha256.New, shared, salt, wrapInfo, messageKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	return newGCM(key)
+}
+
+// MarshalPublicKey encodes an X25519 public key as a PEM block
+func MarshalPublicKey(key *ecdh.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// ParsePublicKey decodes an X25519 public key from a PEM block made by MarshalPublicKey
+func ParsePublicKey(data []byte) (*ecdh.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	publicKey, ok := key.(*ecdh.PublicKey)
+	if !ok || publicKey.Curve() != ecdh.X25519() {
+		return nil, errors.New("public key is not an X25519 key")
+	}
+
+	return publicKey, nil
+}
+
+// MarshalPrivateKey encodes an X25519 private key as a PEM block
+func MarshalPrivateKey(key *ecdh.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKey decodes an X25519 private key from a PEM block made by MarshalPrivateKey
+func ParsePrivateKey(data []byte) (*ecdh.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	privateKey, ok := key.(*ecdh.PrivateKey)
+	if !ok || privateKey.Curve() != ecdh.X25519() {
+		return nil, errors.New("private key is not an X25519 key")
+	}
+
+	return privateKey, nil
+}
@@ -0,0 +1,153 @@
+package stego
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestSealForOpenWith(t *testing.T) {
+	alice, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() unexpected error %v", err)
+	}
+	bob, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() unexpected error %v", err)
+	}
+	eve, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() unexpected error %v", err)
+	}
+
+	type args struct {
+		key    *ecdh.PrivateKey
+		change func(header *Header, sealed []byte)
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name:    "first recipient",
+			args:    args{key: alice},
+			wantErr: nil,
+		},
+		{
+			name:    "second recipient",
+			args:    args{key: bob},
+			wantErr: nil,
+		},
+		{
+			name:    "not a recipient",
+			args:    args{key: eve},
+			wantErr: ErrNotRecipient,
+		},
+		{
+			name:    "missing key",
+			args:    args{key: nil},
+			wantErr: ErrKeyRequired,
+		},
+		{
+			name: "changed data",
+			args: args{
+				key: bob,
+				change: func(header *Header, sealed []byte) {
+					sealed[0] ^= 0x01
+				},
+			},
+			wantErr: ErrAuthentication,
+		},
+		{
+			name: "changed flags",
+			args: args{
+				key: bob,
+				change: func(header *Header, sealed []byte) {
+					header.Flags ^= FlagTransparent
+				},
+			},
+			wantErr: ErrAuthentication,
+		},
+		{
+			name: "checksum added after sealing",
+			args: args{
+				key: bob,
+				change: func(header *Header, sealed []byte) {
+					header.SetChecksum(sealed)
+				},
+			},
+			wantErr: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("Here's the hidden data")
+			header := Header{Version: Version, Depth: 1, Channels: RGB}
+			sealed, err := SealFor(&header, []*ecdh.PublicKey{alice.PublicKey(), bob.PublicKey()}, data)
+			if err != nil {
+				t.Fatalf("SealFor() unexpected error %v", err)
+			}
+			if header.Flags&FlagEncrypted == 0 {
+				t.Fatalf("SealFor() did not set FlagEncrypted")
+			}
+			if len(header.Recipients) != 2 {
+				t.Fatalf("SealFor() wrapped %d keys, want 2", len(header.Recipients))
+			}
+
+			if tt.args.change != nil {
+				tt.args.change(&header, sealed)
+			}
+
+			got, err := OpenWith(header, tt.args.key, sealed)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("OpenWith() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(got, data) {
+				t.Errorf("OpenWith() = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestKeyPEM(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() unexpected error %v", err)
+	}
+
+	privateData, err := MarshalPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey() unexpected error %v", err)
+	}
+	privateKey, err := ParsePrivateKey(privateData)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey() unexpected error %v", err)
+	}
+	if !privateKey.Equal(key) {
+		t.Errorf("ParsePrivateKey() did not return the marshaled key")
+	}
+
+	publicData, err := MarshalPublicKey(key.PublicKey())
+	if err != nil {
+		t.Fatalf("MarshalPublicKey() unexpected error %v", err)
+	}
+	publicKey, err := ParsePublicKey(publicData)
+	if err != nil {
+		t.Fatalf("ParsePublicKey() unexpected error %v", err)
+	}
+	if !publicKey.Equal(key.PublicKey()) {
+		t.Errorf("ParsePublicKey() did not return the marshaled key")
+	}
+
+	_, err = ParsePublicKey(privateData)
+	if err == nil {
+		t.Errorf("ParsePublicKey() expected an error for a private key")
+	}
+	_, err = ParsePrivateKey(publicData)
+	if err == nil {
+		t.Errorf("ParsePrivateKey() expected an error for a public key")
+	}
+}
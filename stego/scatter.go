@@ -0,0 +1,73 @@
+package stego
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+)
+
+// feistelRounds is the number of rounds used by the permutation's feistel network
+const feistelRounds = 4
+
+// permutation is a key seeded pseudorandom permutation of the integers [0, n).
+// It's built from a small feistel network so the position of any one sample can be
+// calculated on its own, without having to shuffle every sample in the image first
+type permutation struct {
+	n        uint64
+	halfBits int
+	mask     uint64
+	keys     [feistelRounds]uint64
+}
+
+// newPermutation creates a permutation of [0, n) seeded by key
+func newPermutation(key string, n int) *permutation {
+	sum := sha256.Sum256([]byte(key))
+	var keys [feistelRounds]uint64
+	for i := range keys {
+		keys[i] = binary.BigEndian.Uint64(sum[i*8:])
+	}
+
+	// the feistel network permutes values with an even number of bits, use the
+	// smallest one that covers n so values outside [0, n) are rare
+	halfBits := (bits.Len64(uint64(n)) + 1) / 2
+	return &permutation{
+		n:        uint64(n),
+		halfBits: halfBits,
+		mask:     1<<halfBits - 1,
+		keys:     keys,
+	}
+}
+
+// at returns the value at position i of the permutation
+func (p *permutation) at(i int) int {
+	// values outside of [0, n) are run through the network again until they land
+	// inside it, this keeps the result a permutation of [0, n)
+	x := p.encrypt(uint64(i))
+	for x >= p.n {
+		x = p.encrypt(x)
+	}
+
+	return int(x)
+}
+
+// encrypt runs x through the feistel network
+func (p *permutation) encrypt(x uint64) uint64 {
+	left := x >> p.halfBits
+	right := x & p.mask
+	for _, key := range p.keys {
+		left, right = right, left^(mix(right^key)&p.mask)
+	}
+
+	return left<<p.halfBits | right
+}
+
+// mix is the splitmix64 finalizer, it's used as the round function of the
+// feistel network
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xBF58476D1CE4E5B9
+	x ^= x >> 27
+	x *= 0x94D049BB133111EB
+	x ^= x >> 31
+	return x
+}
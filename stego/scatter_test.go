@@ -0,0 +1,71 @@
+package stego
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_permutation(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 17, 256, 1000, 4099} {
+		p := newPermutation("key", n)
+		seen := make([]bool, n)
+		for i := 0; i < n; i++ {
+			v := p.at(i)
+			if v < 0 || v >= n {
+				t.Fatalf("at(%d) = %d, out of range for n = %d", i, v, n)
+			}
+			if seen[v] {
+				t.Fatalf("at(%d) = %d, value repeated for n = %d", i, v, n)
+			}
+			seen[v] = true
+		}
+	}
+}
+
+func Test_permutationKeys(t *testing.T) {
+	a := newPermutation("key a", 1000)
+	b := newPermutation("key b", 1000)
+
+	same := 0
+	inOrder := 0
+	for i := 0; i < 1000; i++ {
+		if a.at(i) == b.at(i) {
+			same++
+		}
+		if a.at(i) == i {
+			inOrder++
+		}
+	}
+	if same > 20 || inOrder > 20 {
+		t.Errorf("permutations are not scattered, %d shared positions and %d in order", same, inOrder)
+	}
+}
+
+func TestScatteredWriterReader(t *testing.T) {
+	data := []byte("Here's the hidden data")
+	layout := Layout{Channels: RGBA, Transparent: true, Key: "key"}
+	pix := bytes.Repeat([]byte{0xAA}, 1000)
+
+	w := NewWriter(pix, layout)
+	w.Write(data)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() unexpected error %v", err)
+	}
+
+	// the data should be spread over the whole image, not packed at the start
+	if bytes.Equal(pix[900:], bytes.Repeat([]byte{0xAA}, 100)) {
+		t.Errorf("Write() did not scatter data over the samples")
+	}
+
+	got := make([]byte, len(data))
+	NewReader(pix, layout).Read(got)
+	if !bytes.Equal(got, data) {
+		t.Errorf("Read() = %q, want %q", got, data)
+	}
+
+	layout.Key = "wrong key"
+	NewReader(pix, layout).Read(got)
+	if bytes.Equal(got, data) {
+		t.Errorf("Read() with the wrong key found the data")
+	}
+}
@@ -0,0 +1,319 @@
+package stego
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bjatkin/imgdemo/bits"
+)
+
+// ErrMissingShards is returned when some of the images a payload was split across
+// were not given to JoinShards
+var ErrMissingShards = errors.New("some shards of the hidden data are missing")
+
+// Shard identifies one part of a payload that was split across several images
+type Shard struct {
+	// Set is a random ID shared by every shard of the same payload
+	Set uint64
+	// Index is the position of this shard in the payload, starting at 0
+	Index uint64
+	// Total is the number of shards the payload was split into
+	Total uint64
+
+	// Need is the number of shards needed to recover an erasure coded payload, it's 0
+	// when every shard is needed
+	Need uint64
+	// Size is the length of the whole payload when it's erasure coded, each shard is
+	// padded to the same length so this is needed to remove the padding
+	Size uint64
+}
+
+// NewShardSet returns the first shard of a new set split into total shards, with a
+// random set ID. When need is less than total the payload is erasure coded so any
+// need shards are enough to recover it
+func NewShardSet(total, need int) (Shard, error) {
+	if need < 1 || need > total {
+		return Shard{}, fmt.Errorf("the number of images needed must be between 1 and %d", total)
+	}
+	if need < total && total > bits.MaxCodeword {
+		return Shard{}, fmt.Errorf("erasure coding supports at most %d images", bits.MaxCodeword)
+	}
+
+	var id [8]byte
+	_, err := rand.Read(id[:])
+	if err != nil {
+		return Shard{}, fmt.Errorf("failed to generate set ID: %w", err)
+	}
+
+	shard := Shard{Set: binary.BigEndian.Uint64(id[:]), Total: uint64(total)}
+	if need < total {
+		shard.Need = uint64(need)
+	}
+
+	return shard, nil
+}
+
+// marshal encodes the shard as the set ID followed by the uvarint index and total,
+// then the uvarint need and size if the payload is erasure coded
+func (s Shard) marshal() []byte {
+	buf := binary.BigEndian.AppendUint64(nil, s.Set)
+	buf = binary.AppendUvarint(buf, s.Index)
+	buf = binary.AppendUvarint(buf, s.Total)
+	if s.Need != 0 {
+		buf = binary.AppendUvarint(buf, s.Need)
+		buf = binary.AppendUvarint(buf, s.Size)
+	}
+
+	return buf
+}
+
+// unmarshalShard decodes a shard encoded by marshal
+func unmarshalShard(value []byte) (Shard, error) {
+	if len(value) < 8 {
+		return Shard{}, fmt.Errorf("invalid shard %v", value)
+	}
+
+	r := bytes.NewReader(value[8:])
+	index, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Shard{}, fmt.Errorf("invalid shard index: %w", err)
+	}
+	total, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Shard{}, fmt.Errorf("invalid shard total: %w", err)
+	}
+	if total == 0 || index >= total {
+		return Shard{}, fmt.Errorf("invalid shard %d of %d", index, total)
+	}
+
+	shard := Shard{Set: binary.BigEndian.Uint64(value), Index: index, Total: total}
+	if r.Len() == 0 {
+		return shard, nil
+	}
+
+	shard.Need, err = binary.ReadUvarint(r)
+	if err != nil {
+		return Shard{}, fmt.Errorf("invalid shard need: %w", err)
+	}
+	shard.Size, err = binary.ReadUvarint(r)
+	if err != nil {
+		return Shard{}, fmt.Errorf("invalid shard size: %w", err)
+	}
+	if shard.Need == 0 || shard.Need >= total || total > bits.MaxCodeword || r.Len() != 0 {
+		return Shard{}, fmt.Errorf("invalid erasure coded shard, %d of %d needed", shard.Need, total)
+	}
+
+	return shard, nil
+}
+
+// SplitPayload splits data into one part per capacity, the size of each part is
+// proportional to its capacity so the data is spread evenly over every image
+func SplitPayload(data []byte, capacities []int) ([][]byte, error) {
+	total := 0
+	for _, capacity := range capacities {
+		total += capacity
+	}
+	if len(data) > total {
+		return nil, fmt.Errorf("data needs %d bytes but the images only have %d bytes available", len(data), total)
+	}
+
+	sizes := make([]int, len(capacities))
+	remaining := len(data)
+	for i, capacity := range capacities {
+		sizes[i] = int(int64(len(data)) * int64(capacity) / int64(max(total, 1)))
+		remaining -= sizes[i]
+	}
+	// rounding down leaves a few bytes over, hand them out to any part with room
+	for i := 0; remaining > 0; i++ {
+		if sizes[i] < capacities[i] {
+			sizes[i]++
+			remaining--
+		}
+		if i == len(sizes)-1 {
+			i = -1
+		}
+	}
+
+	parts := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		parts[i], data = data[:size], data[size:]
+	}
+
+	return parts, nil
+}
+
+// EncodeErasure splits data into need equal shards, padding the last one, and then adds
+// parity shards until there are total of them. Any need of the shards are enough to
+// recover the data with JoinShards
+func EncodeErasure(data []byte, need, total int) ([][]byte, error) {
+	size := (len(data) + need - 1) / need
+	shards := make([][]byte, total)
+	for i := range shards {
+		shards[i] = make([]byte, size)
+		if i < need {
+			copy(shards[i], data[min(i*size, len(data)):])
+		}
+	}
+
+	// byte j of every shard together make up one Reed-Solomon codeword
+	column := make([]byte, need)
+	for j := 0; j < size; j++ {
+		for i := range column {
+			column[i] = shards[i][j]
+		}
+
+		parity, err := bits.RSEncode(column, total-need)
+		if err != nil {
+			return nil, err
+		}
+		for i, b := range parity {
+			shards[need+i][j] = b
+		}
+	}
+
+	return shards, nil
+}
+
+// ErasureCapacity returns the most data that can be erasure coded into shards that
+// each fit in one of the capacities
+func ErasureCapacity(capacities []int, need int) int {
+	if len(capacities) == 0 {
+		return 0
+	}
+
+	return slices.Min(capacities) * need
+}
+
+// JoinShards puts the data found in several images back together in shard order. The
+// images can be given in any order, but they must all come from the same set, unless
+// the set is erasure coded, see joinErasure. The returned header describes the whole
+// payload. A single header that isn't part of a set is returned as is
+func JoinShards(headers []Header, data [][]byte) (Header, []byte, error) {
+	if len(headers) == 0 {
+		return Header{}, nil, ErrNoPayload
+	}
+	if len(headers) == 1 && headers[0].Shard.Total == 0 {
+		return headers[0], data[0], nil
+	}
+
+	if slices.ContainsFunc(headers, func(header Header) bool { return header.Shard.Need != 0 }) {
+		return joinErasure(headers, data)
+	}
+
+	first := headers[0].Shard
+
+	shards := make([][]byte, first.Total)
+	found := make([]bool, first.Total)
+	for i, header := range headers {
+		if header.Shard.Total == 0 {
+			return Header{}, nil, fmt.Errorf("image %d does not hold a shard, only one image is needed", i+1)
+		}
+		if header.Shard.Set != first.Set || header.Shard.Total != first.Total {
+			return Header{}, nil, fmt.Errorf("image %d is from a different set of shards", i+1)
+		}
+
+		shards[header.Shard.Index] = data[i]
+		found[header.Shard.Index] = true
+	}
+
+	var missing []string
+	for i := range found {
+		if !found[i] {
+			missing = append(missing, fmt.Sprint(i+1))
+		}
+	}
+	if len(missing) > 0 {
+		return Header{}, nil, fmt.Errorf("%w: found %d of %d shards, missing %s", ErrMissingShards, int(first.Total)-len(missing), first.Total, strings.Join(missing, ", "))
+	}
+
+	// every shard was verified on its own, the joined data has no checksum
+	header := headers[0]
+	header.Shard = Shard{}
+	header.Flags &^= FlagChecksum
+	header.Checksum = 0
+	joined := bytes.Join(shards, nil)
+	header.Length = uint64(len(joined))
+	return header, joined, nil
+}
+
+// joinErasure recovers an erasure coded payload from any Need of its shards. Since only
+// Need shards are required, images from other sets are ignored rather than rejected,
+// and the set with the most shards is the one recovered. Shards that don't match the
+// size of the others are treated as missing
+func joinErasure(headers []Header, data [][]byte) (Header, []byte, error) {
+	// the index is the only part of the shard that differs within a set
+	set := func(shard Shard) Shard {
+		shard.Index = 0
+		return shard
+	}
+
+	counts := map[Shard]int{}
+	best := -1
+	for i, header := range headers {
+		if header.Shard.Need == 0 {
+			continue
+		}
+		key := set(header.Shard)
+		counts[key]++
+		if best == -1 || counts[key] > counts[set(headers[best].Shard)] {
+			best = i
+		}
+	}
+
+	first := headers[best].Shard
+	size := len(data[best])
+	shards := make([][]byte, first.Total)
+	for i, header := range headers {
+		if set(header.Shard) != set(first) || len(data[i]) != size {
+			continue
+		}
+
+		shards[header.Shard.Index] = data[i]
+	}
+
+	var erasures []int
+	for i, shard := range shards {
+		if shard == nil {
+			erasures = append(erasures, i)
+			shards[i] = make([]byte, size)
+		}
+	}
+	found := len(shards) - len(erasures)
+	if found < int(first.Need) {
+		return Header{}, nil, fmt.Errorf("%w: found %d of %d shards, %d are needed", ErrMissingShards, found, first.Total, first.Need)
+	}
+
+	if first.Size > uint64(size)*first.Need {
+		return Header{}, nil, fmt.Errorf("%w: data size %d is larger than the shards", ErrCorrupted, first.Size)
+	}
+
+	codeword := make([]byte, len(shards))
+	parity := int(first.Total - first.Need)
+	for j := 0; j < size && len(erasures) > 0; j++ {
+		for i, shard := range shards {
+			codeword[i] = shard[j]
+		}
+
+		err := bits.RSRecover(codeword, parity, erasures)
+		if err != nil {
+			return Header{}, nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		for _, i := range erasures {
+			shards[i][j] = codeword[i]
+		}
+	}
+
+	// every shard was verified on its own, the joined data has no checksum
+	header := headers[best]
+	header.Shard = Shard{}
+	header.Flags &^= FlagChecksum
+	header.Checksum = 0
+	joined := bytes.Join(shards[:first.Need], nil)[:first.Size]
+	header.Length = first.Size
+	return header, joined, nil
+}
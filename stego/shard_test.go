@@ -0,0 +1,198 @@
+package stego
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPayload(t *testing.T) {
+	type args struct {
+		data       []byte
+		capacities []int
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "equal capacities",
+			args: args{data: make([]byte, 10), capacities: []int{10, 10}},
+			want: []int{5, 5},
+		},
+		{
+			name: "proportional to capacity",
+			args: args{data: make([]byte, 9), capacities: []int{20, 10}},
+			want: []int{6, 3},
+		},
+		{
+			name: "remainder",
+			args: args{data: make([]byte, 10), capacities: []int{4, 4, 4}},
+			want: []int{4, 3, 3},
+		},
+		{
+			name: "full",
+			args: args{data: make([]byte, 7), capacities: []int{5, 2}},
+			want: []int{5, 2},
+		},
+		{
+			name:    "too large",
+			args:    args{data: make([]byte, 8), capacities: []int{5, 2}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := SplitPayload(tt.args.data, tt.args.capacities)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitPayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var got []int
+			for _, part := range parts {
+				got = append(got, len(part))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitPayload() sizes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinShards(t *testing.T) {
+	shard := func(set, index, total uint64) Header {
+		return Header{Version: Version, Flags: FlagCompressed, Shard: Shard{Set: set, Index: index, Total: total}}
+	}
+
+	type args struct {
+		headers []Header
+		data    [][]byte
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "single image",
+			args: args{
+				headers: []Header{{Version: Version, Flags: FlagCompressed, Length: 22}},
+				data:    [][]byte{[]byte("Here's the hidden data")},
+			},
+			want: []byte("Here's the hidden data"),
+		},
+		{
+			name: "out of order",
+			args: args{
+				headers: []Header{shard(7, 2, 3), shard(7, 0, 3), shard(7, 1, 3)},
+				data:    [][]byte{[]byte("data"), []byte("Here's "), []byte("the hidden ")},
+			},
+			want: []byte("Here's the hidden data"),
+		},
+		{
+			name: "missing shard",
+			args: args{
+				headers: []Header{shard(7, 0, 3), shard(7, 2, 3)},
+				data:    [][]byte{[]byte("Here's "), []byte("data")},
+			},
+			wantErr: ErrMissingShards,
+		},
+		{
+			name: "different sets",
+			args: args{
+				headers: []Header{shard(7, 0, 2), shard(8, 1, 2)},
+				data:    [][]byte{[]byte("Here's "), []byte("data")},
+			},
+			wantErr: errors.New("image 2 is from a different set of shards"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, got, err := JoinShards(tt.args.headers, tt.args.data)
+			if tt.wantErr != nil {
+				if err == nil || (!errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error()) {
+					t.Fatalf("JoinShards() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("JoinShards() unexpected error %v", err)
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("JoinShards() = %q, want %q", got, tt.want)
+			}
+			if header.Shard != (Shard{}) || header.Length != uint64(len(tt.want)) || header.Flags != FlagCompressed {
+				t.Errorf("JoinShards() header = %+v", header)
+			}
+		})
+	}
+}
+
+func TestEncodeErasure(t *testing.T) {
+	data := []byte("Here's the hidden data, any three of the five images are enough to find it")
+	shards, err := EncodeErasure(data, 3, 5)
+	if err != nil {
+		t.Fatalf("EncodeErasure() unexpected error %v", err)
+	}
+
+	headers := make([]Header, len(shards))
+	for i := range shards {
+		headers[i] = Header{Version: Version, Shard: Shard{Set: 7, Index: uint64(i), Total: 5, Need: 3, Size: uint64(len(data))}}
+	}
+
+	// a shard from another set and an image that isn't part of any set
+	foreign := []Header{
+		{Version: Version, Shard: Shard{Set: 8, Index: 0, Total: 5, Need: 3, Size: uint64(len(data))}},
+		{Version: Version, Length: 4},
+	}
+
+	tests := []struct {
+		name    string
+		found   []int
+		foreign bool
+		wantErr error
+	}{
+		{name: "every shard", found: []int{0, 1, 2, 3, 4}},
+		{name: "with foreign images", found: []int{3, 0, 4}, foreign: true},
+		{name: "too few shards with foreign images", found: []int{0, 4}, foreign: true, wantErr: ErrMissingShards},
+		{name: "only data shards", found: []int{0, 1, 2}},
+		{name: "only parity shards", found: []int{4, 3, 1}},
+		{name: "too few shards", found: []int{0, 4}, wantErr: ErrMissingShards},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var foundHeaders []Header
+			var foundData [][]byte
+			for _, i := range tt.found {
+				foundHeaders = append(foundHeaders, headers[i])
+				foundData = append(foundData, append([]byte{}, shards[i]...))
+			}
+			if tt.foreign {
+				foundHeaders = append(foreign, foundHeaders...)
+				foundData = append([][]byte{append([]byte{}, shards[1]...), []byte("data")}, foundData...)
+			}
+
+			header, got, err := JoinShards(foundHeaders, foundData)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("JoinShards() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("JoinShards() = %q, want %q", got, data)
+			}
+			if header.Length != uint64(len(data)) {
+				t.Errorf("JoinShards() length = %d, want %d", header.Length, len(data))
+			}
+		})
+	}
+}